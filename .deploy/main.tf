@@ -54,6 +54,10 @@ module "docker" {
     allowedUsers      = sensitive(var.allowedUsers)
     gcpProjectID      = var.gcpProjectID
     rateLimit         = var.rateLimit
+    publicUrl         = var.publicUrl
+    access            = var.access
+    channels          = var.channels
+    history           = var.history
   }
 }
 
@@ -32,7 +32,7 @@ resource "local_file" "dockerfile" {
 }
 
 resource "local_file" "config" {
-  filename = "../cmd/config.json"
+  filename = "../cmd/defaults/config.json"
   content  = jsonencode(var.config)
 }
 
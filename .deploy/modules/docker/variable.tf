@@ -59,9 +59,59 @@ variable "bundle" {
 variable "config" {
   type = object({
     mcpServers = map(object({
-      command = string
-      args    = optional(list(string))
-      env     = optional(map(any))
+      type        = optional(string)
+      command     = optional(string)
+      args        = optional(list(string))
+      env         = optional(map(any))
+      cwd         = optional(string)
+      inheritEnv  = optional(bool)
+      url         = optional(string)
+      headers     = optional(map(string))
+      bearerToken = optional(string)
+      listen      = optional(bool)
+      perUser     = optional(bool)
+      required    = optional(bool)
+      sampling = optional(object({
+        maxTokens = optional(number)
+        approval  = optional(bool)
+      }))
+      roots = optional(object({
+        default = optional(list(object({
+          uri  = string
+          name = optional(string)
+        })))
+        channels = optional(map(list(object({
+          uri  = string
+          name = optional(string)
+        }))))
+      }))
+      tools = optional(object({
+        include            = optional(list(string))
+        exclude            = optional(list(string))
+        approval           = optional(list(string))
+        approveDestructive = optional(bool)
+        overrides = optional(map(object({
+          alias       = optional(string)
+          description = optional(string)
+        })))
+      }))
+      tls = optional(object({
+        caFile             = optional(string)
+        certFile           = optional(string)
+        keyFile            = optional(string)
+        serverName         = optional(string)
+        insecureSkipVerify = optional(bool)
+      }))
+      oauth = optional(object({
+        grantType             = optional(string)
+        clientId              = string
+        clientSecret          = optional(string)
+        refreshToken          = optional(string)
+        scopes                = optional(list(string))
+        authServerMetadataUrl = optional(string)
+        tokenFile             = optional(string)
+        tokenDir              = optional(string)
+      }))
     }))
     timeoutNs         = number
     llmProviderName   = string
@@ -72,12 +122,51 @@ variable "config" {
     slackSigninSecret = string
     allowedUsers      = list(string)
     gcpProjectID      = string
+    publicUrl         = optional(string)
     rateLimit = optional(object({
       enable    = optional(bool, false)
       limit     = optional(number, 20)
       burst     = optional(number)
       expiresIn = optional(number, 300)
     }))
+    access = optional(object({
+      roles = optional(map(object({
+        users  = optional(list(string))
+        groups = optional(list(string))
+      })))
+      policies = optional(list(object({
+        roles   = list(string)
+        servers = list(string)
+        tools   = optional(list(string))
+      })))
+    }))
+    channels = optional(object({
+      allowed = optional(list(string))
+      denied  = optional(list(string))
+      profiles = optional(map(object({
+        llmProviderName = optional(string)
+        llmApiKey       = optional(string)
+        llmBaseUrl      = optional(string)
+        llmModelName    = optional(string)
+        systemPrompt    = optional(string)
+        servers         = optional(list(string))
+        tools           = optional(list(string))
+        rateLimit = optional(object({
+          enable    = optional(bool, false)
+          limit     = optional(number, 20)
+          burst     = optional(number)
+          expiresIn = optional(number, 300)
+        }))
+        history = optional(object({
+          disable   = optional(bool, false)
+          maxTokens = optional(number)
+        }))
+      })))
+    }))
+    history = optional(object({
+      disable   = optional(bool, false)
+      maxTokens = optional(number)
+    }))
   })
   sensitive = true
 }
\ No newline at end of file
@@ -1,8 +1,58 @@
 variable "mcpServers" {
   type = map(object({
-    command = string
-    args    = optional(list(string))
-    env     = optional(map(any))
+    type        = optional(string)
+    command     = optional(string)
+    args        = optional(list(string))
+    env         = optional(map(any))
+    cwd         = optional(string)
+    inheritEnv  = optional(bool)
+    url         = optional(string)
+    headers     = optional(map(string))
+    bearerToken = optional(string)
+    listen      = optional(bool)
+    perUser     = optional(bool)
+    required    = optional(bool)
+    sampling = optional(object({
+      maxTokens = optional(number)
+      approval  = optional(bool)
+    }))
+    roots = optional(object({
+      default = optional(list(object({
+        uri  = string
+        name = optional(string)
+      })))
+      channels = optional(map(list(object({
+        uri  = string
+        name = optional(string)
+      }))))
+    }))
+    tools = optional(object({
+      include            = optional(list(string))
+      exclude            = optional(list(string))
+      approval           = optional(list(string))
+      approveDestructive = optional(bool)
+      overrides = optional(map(object({
+        alias       = optional(string)
+        description = optional(string)
+      })))
+    }))
+    tls = optional(object({
+      caFile             = optional(string)
+      certFile           = optional(string)
+      keyFile            = optional(string)
+      serverName         = optional(string)
+      insecureSkipVerify = optional(bool)
+    }))
+    oauth = optional(object({
+      grantType             = optional(string)
+      clientId              = string
+      clientSecret          = optional(string)
+      refreshToken          = optional(string)
+      scopes                = optional(list(string))
+      authServerMetadataUrl = optional(string)
+      tokenFile             = optional(string)
+      tokenDir              = optional(string)
+    }))
   }))
   sensitive = true
   nullable  = false
@@ -119,5 +169,58 @@ variable "rateLimit" {
   nullable = true
 }
 
+variable "publicUrl" {
+  type    = string
+  default = null
+}
 
+variable "access" {
+  type = object({
+    roles = optional(map(object({
+      users  = optional(list(string))
+      groups = optional(list(string))
+    })))
+    policies = optional(list(object({
+      roles   = list(string)
+      servers = list(string)
+      tools   = optional(list(string))
+    })))
+  })
+  default = null
+}
 
+variable "channels" {
+  type = object({
+    allowed = optional(list(string))
+    denied  = optional(list(string))
+    profiles = optional(map(object({
+      llmProviderName = optional(string)
+      llmApiKey       = optional(string)
+      llmBaseUrl      = optional(string)
+      llmModelName    = optional(string)
+      systemPrompt    = optional(string)
+      servers         = optional(list(string))
+      tools           = optional(list(string))
+      rateLimit = optional(object({
+        enable    = optional(bool, false)
+        limit     = optional(number, 20)
+        burst     = optional(number)
+        expiresIn = optional(number, 300)
+      }))
+      history = optional(object({
+        disable   = optional(bool, false)
+        maxTokens = optional(number)
+      }))
+    })))
+  })
+  default   = null
+  sensitive = true
+}
+
+variable "history" {
+  type = object({
+    disable   = optional(bool, false)
+    maxTokens = optional(number)
+  })
+  default = null
+}
@@ -2,65 +2,65 @@ package main
 
 import (
 	"context"
-	_ "embed"
-	"encoding/json"
+	"embed"
+	"flag"
 	"fmt"
 	"github.com/labstack/echo/v4"
-	"github.com/mark3labs/mcp-go/client"
-	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcphost/pkg/llm"
-	"github.com/mark3labs/mcphost/pkg/llm/anthropic"
-	"github.com/mark3labs/mcphost/pkg/llm/google"
-	"github.com/mark3labs/mcphost/pkg/llm/openai"
+	"github.com/miyamo2/slackbot-mcp-host/internal/access"
 	"github.com/miyamo2/slackbot-mcp-host/internal/app"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
 	"github.com/miyamo2/slackbot-mcp-host/internal/interfaces"
+	"github.com/miyamo2/slackbot-mcp-host/internal/llmprovider"
 	"github.com/miyamo2/slackbot-mcp-host/internal/log"
+	"github.com/miyamo2/slackbot-mcp-host/internal/mcpclient"
+	"github.com/miyamo2/slackbot-mcp-host/internal/toolname"
 	"github.com/pkg/errors"
 	"github.com/slack-go/slack"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"slices"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-//go:embed config.json
-var config string
+//go:embed all:defaults
+var defaults embed.FS
 
-type Config struct {
-	MCPServers       map[string]MCPServerConfig `json:"mcpServers"`
-	TimeoutNs        int64                      `json:"timeoutNs"`
-	LLMProviderName  string                     `json:"llmProviderName"`
-	LLMApiKey        string                     `json:"llmApiKey"`
-	LLMBaseURL       string                     `json:"llmBaseUrl"`
-	LLMModelName     string                     `json:"llmModelName"`
-	SlackBotToken    string                     `json:"slackBotToken"`
-	SackSinginSecret string                     `json:"slackSigninSecret"`
-	AllowedUsers     []string                   `json:"allowedUsers"`
-	Port             int                        `json:"port"`
-	GCPProjectId     string                     `json:"gcpProjectId"`
-	RateLimit        RateLimitConfig            `json:"rateLimit"`
-}
-
-type MCPServerConfig struct {
-	Command string         `json:"command"`
-	Args    []string       `json:"args"`
-	Env     map[string]any `json:"env"`
-}
+// defaultConfigPath is the path of the optional default configuration embedded in the binary.
+const defaultConfigPath = "defaults/config.json"
 
-type RateLimitConfig struct {
-	Enable    bool    `json:"enable"`
-	Limit     float64 `json:"limit"`
-	Burst     int     `json:"burst"`
-	ExpressIn int64   `json:"expiresIn"`
-}
+// commandValidate is the subcommand that validates the config without starting the server.
+const commandValidate = "validate"
 
 func main() {
-	// Parse the config
-	var cfg Config
-	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
-		slog.Error("failed to parse config", slog.String("error", err.Error()))
+	args := os.Args[1:]
+	var command string
+	if len(args) > 0 && args[0] == commandValidate {
+		command, args = args[0], args[1:]
+	}
+	configPath := flag.String("config", os.Getenv(config.EnvPrefix+"CONFIG"), "path to the config file")
+	secretsDir := flag.String("secrets-dir", os.Getenv(config.EnvPrefix+"SECRETS_DIR"), "path to the directory containing secret files")
+	reloadInterval := flag.Duration("reload-interval", 30*time.Second, "interval to check the config file and secrets directory for changes. 0 disables it")
+	flag.CommandLine.Parse(args)
+
+	if command == commandValidate {
+		if _, err := loadConfig(*configPath, *secretsDir); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Println("config is valid")
+		return
+	}
+
+	// Load the config
+	cfg, err := loadConfig(*configPath, *secretsDir)
+	if err != nil {
+		slog.Error("failed to load config", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
 	slog.SetDefault(slog.New(log.NewHandler(cfg.GCPProjectId)))
@@ -70,41 +70,20 @@ func main() {
 		// Set default timeout
 		duration = 10 * time.Second
 	}
-	if cfg.Port == 0 {
+	port := cfg.Port
+	if port == 0 {
 		// Set default port
-		cfg.Port = 8080
+		port = 8080
 	}
 
-	clients, closer, err := func() (map[string]client.MCPClient, func() error, error) {
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		return mcpClientFromConfig(ctx, cfg)
-	}()
-	if err != nil {
-		slog.Error("failed to create mcp clients", slog.String("error", err.Error()))
-		os.Exit(1)
-	}
-	defer closer()
-
-	var allTools []llm.Tool
-	for name, client := range clients {
-		ctx, cancel := context.WithCancel(context.Background())
-		tools, err := func() ([]llm.Tool, error) {
-			defer cancel()
-			return llmToolsFromMCPClient(ctx, client, name)
-		}()
-		if err != nil {
-			slog.Error("failed to list tools", slog.String("error", err.Error()))
-			continue
-		}
-		allTools = slices.Concat(allTools, tools)
-		slog.Info("added tools from mcp client", slog.String("server", name), slog.Any("tools", tools))
-	}
+	names := toolname.NewRegistry(ruleOf(cfg))
+	pool := mcpclient.NewPool(names)
+	userPool := mcpclient.NewUserPool(cfg.PublicURL, names)
 
-	llmProvider, err := func() (llm.Provider, error) {
+	llmProviders, err := func() (map[config.LLMConfig]llm.Provider, error) {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
-		return llmProviderFromConfig(ctx, cfg)
+		return llmProvidersFromConfig(ctx, cfg, nil)
 	}()
 	if err != nil {
 		slog.Error("failed to create llm provider", slog.String("error", err.Error()))
@@ -112,11 +91,14 @@ func main() {
 	}
 
 	bot := slack.New(cfg.SlackBotToken)
-	if _, err := bot.AuthTest(); err != nil {
+	auth, err := bot.AuthTest()
+	if err != nil {
 		slog.Error("failed to authenticate bot token", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
 
+	acl := access.New(cfg.Access, bot)
+
 	alowedUsers := make(map[string]bool)
 	for _, user := range cfg.AllowedUsers {
 		alowedUsers[user] = true
@@ -125,31 +107,119 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 	defer cancel()
 
+	// current is the latest config, which the profiles of the channels are resolved from
+	var current atomic.Pointer[config.Config]
+	current.Store(cfg)
+	profileOf := func(channel string) (config.Profile, bool) {
+		return current.Load().Profile(channel)
+	}
+
 	e := echo.New()
 	e.GET("/health", func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
+	// the failed optional servers are reported in the states, but do not make the bot unhealthy
+	e.GET("/health/mcp", func(c echo.Context) error {
+		states := pool.States()
+		servers := current.Load().MCPServers
+		for name, state := range states {
+			if state == mcpclient.StateFailed && servers[name].Required {
+				return c.JSON(http.StatusServiceUnavailable, states)
+			}
+		}
+		return c.JSON(http.StatusOK, states)
+	})
 
 	middlewares := []echo.MiddlewareFunc{
 		interfaces.NewSecretVerify(cfg.SackSinginSecret),
 		interfaces.NewParseEvent(),
 		interfaces.NewAuth(alowedUsers, bot),
+		interfaces.NewChannelProfile(profileOf),
 		interfaces.NewSessionMiddleware(ctx),
 	}
-	if cfg.RateLimit.Enable {
-		middlewares = append(middlewares,
-			interfaces.NewRateLimiter(
-				cfg.RateLimit.Limit, cfg.RateLimit.Burst, time.Duration(cfg.RateLimit.ExpressIn)*time.Second))
+	commandMiddlewares := []echo.MiddlewareFunc{
+		interfaces.NewSecretVerify(cfg.SackSinginSecret),
+		interfaces.NewParseCommand(),
+		interfaces.NewAuth(alowedUsers, bot),
+		interfaces.NewChannelProfile(profileOf),
+	}
+	// button clicks are not rate limited, as they answer the requests the bot makes
+	interactionMiddlewares := []echo.MiddlewareFunc{
+		interfaces.NewSecretVerify(cfg.SackSinginSecret),
+		interfaces.NewParseInteraction(),
+		interfaces.NewAuth(alowedUsers, bot),
+	}
+	// the rate limit is resolved for each request, as it varies by the profile of the channel
+	rateLimiter := interfaces.NewRateLimiter()
+	middlewares = append(middlewares, rateLimiter)
+	commandMiddlewares = append(commandMiddlewares, rateLimiter)
+	// the use-case is created before the servers start, as they may send requests as soon as they start.
+	// the clients of the servers are handed to the use-case once started.
+	uc := app.NewUseCase(duration, bot, auth.BotID, llmProviders[cfg.LLM()], llmProviders, pool, names, pool.Clients(), userPool, acl)
+	pool.SetSampler(uc)
+	pool.SetElicitor(uc)
+	pool.SetObserver(uc)
+	pool.SetChannelResolver(uc)
+	userPool.SetSampler(uc)
+	userPool.SetElicitor(uc)
+	userPool.SetObserver(uc)
+	userPool.SetChannelResolver(uc)
+
+	// only the required servers are waited for. the optional ones are started in background.
+	if _, err := pool.Apply(context.Background(), cfg.MCPServers); err != nil {
+		slog.Error("failed to create mcp clients", slog.String("error", err.Error()))
+		pool.Close()
+		os.Exit(1)
 	}
+	defer pool.Close()
+	userPool.Apply(context.Background(), cfg.MCPServers)
+	defer userPool.Close()
+	uc.Swap(llmProviders[cfg.LLM()], llmProviders, pool.Clients())
 	e.POST("/slack/events",
-		interfaces.NewHandler(app.NewUseCase(duration, bot, llmProvider, allTools, clients)),
+		interfaces.NewHandler(uc),
 		middlewares...)
+	e.POST("/slack/commands",
+		interfaces.NewCommandHandler(ctx, uc),
+		commandMiddlewares...)
+	e.POST("/slack/interactions",
+		interfaces.NewInteractionHandler(uc),
+		interactionMiddlewares...)
+	e.GET(mcpclient.CallbackPath, interfaces.NewLinkHandler(userPool, bot))
 	e.HTTPErrorHandler = interfaces.NewErrorHandler(bot)
 
+	var watch <-chan struct{}
+	if *reloadInterval > 0 && (*configPath != "" || *secretsDir != "") {
+		watch = config.Watch(ctx, *reloadInterval, *configPath, *secretsDir)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				slog.Info("received SIGHUP")
+			case _, ok := <-watch:
+				// the watch is closed when ctx is done, while the pool is shutting down
+				if !ok {
+					return
+				}
+			}
+			next, nextProviders, err := reload(ctx, cfg, llmProviders, *configPath, *secretsDir, names, pool, userPool, acl, uc)
+			if err != nil {
+				slog.Error("failed to reload config", slog.String("error", err.Error()))
+				continue
+			}
+			cfg, llmProviders = next, nextProviders
+			current.Store(next)
+		}
+	}()
+
 	errChan := make(chan error, 1)
 	go func() {
-		slog.Info("start server.", slog.Int("port", cfg.Port))
-		if err := e.Start(fmt.Sprintf(":%d", cfg.Port)); err != nil {
+		slog.Info("start server.", slog.Int("port", port))
+		if err := e.Start(fmt.Sprintf(":%d", port)); err != nil {
 			errChan <- err
 			return
 		}
@@ -171,125 +241,116 @@ func main() {
 	}
 }
 
-// mcpClientFromConfig creates MCP clients from the given configuration.
-func mcpClientFromConfig(rootCtx context.Context, conf Config) (map[string]client.MCPClient, func() error, error) {
-	clients := make(map[string]client.MCPClient)
-	for name, server := range conf.MCPServers {
-		slog.InfoContext(context.TODO(), "create mcp client", slog.String("name", name))
-		var (
-			c   client.MCPClient
-			err error
-		)
-		switch server.Command {
-		case "sse_server":
-			if len(server.Args) < 1 {
-				return nil, nil, errors.New("missing argument")
-			}
-			host := server.Args[0]
-			var headers map[string]string
-			for k, v := range server.Env {
-				headers[k] = fmt.Sprintf("%v", v)
-			}
-			c, err = client.NewSSEMCPClient(host, client.WithHeaders(headers))
-		default:
-			env := make([]string, 0, len(server.Env))
-			for k, v := range server.Env {
-				env = append(env, fmt.Sprintf("%s=%s", k, v))
-			}
-			c, err = client.NewStdioMCPClient(server.Command, env)
-		}
-		if err != nil {
-			slog.ErrorContext(
-				context.TODO(),
-				`failed to create mcp client`,
-				slog.String("name", name),
-				slog.String("command", server.Command),
-				slog.Any("args", server.Args),
-				slog.Any("env", server.Env),
-				slog.String("error", err.Error()))
-			os.Exit(1)
-		}
-		slog.InfoContext(context.TODO(), "created mcp client",
-			slog.String("name", name),
-			slog.String("command", server.Command),
-			slog.Any("args", server.Args),
-			slog.Any("env", server.Env))
-		initRequest := mcp.InitializeRequest{}
-		initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
-		initRequest.Params.ClientInfo = mcp.Implementation{
-			Name:    "mcphost",
-			Version: "0.1.0",
-		}
-		initRequest.Params.Capabilities = mcp.ClientCapabilities{}
+// loadConfig loads the config from the embedded default, the config file, the secrets directory and environment variables.
+func loadConfig(path, secretsDir string) (*config.Config, error) {
+	embedded, err := defaults.ReadFile(defaultConfigPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, errors.Wrap(err, "failed to read embedded config")
+	}
+	return config.Load(embedded, path, secretsDir)
+}
 
-		slog.InfoContext(context.TODO(), "initialize mcp client", slog.String("name", name))
-		ctx, cancel := context.WithTimeout(rootCtx, 1*time.Minute)
-		_, err = c.Initialize(ctx, initRequest)
-		if err != nil {
-			c.Close()
-			for _, v := range clients {
-				v.Close()
-			}
-			return nil, nil, fmt.Errorf("failed to initialize mcp client: %w", err)
-		}
-		cancel()
-		clients[name] = c
-		slog.InfoContext(context.TODO(), "mcp client initialized",
-			slog.String("name", name),
-			slog.String("command", server.Command),
-			slog.Any("args", server.Args),
-			slog.Any("env", server.Env))
+// reload loads the latest config and applies its MCP servers, LLM settings and access control to the use-case.
+// the clients of the stopped MCP servers are closed after the sessions using them finish.
+//
+//   - currentProviders: The LLM providers of the current config keyed by their settings, reused if unchanged.
+func reload(
+	ctx context.Context,
+	current *config.Config,
+	currentProviders map[config.LLMConfig]llm.Provider,
+	configPath, secretsDir string,
+	names *toolname.Registry,
+	pool *mcpclient.Pool,
+	userPool *mcpclient.UserPool,
+	acl *access.Control,
+	uc *app.UseCase,
+) (*config.Config, map[config.LLMConfig]llm.Provider, error) {
+	slog.InfoContext(ctx, "reload config")
+	next, err := loadConfig(configPath, secretsDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if changed := restartRequired(current, next); len(changed) > 0 {
+		slog.WarnContext(ctx, "some changes require restart to take effect", slog.Any("fields", changed))
+	}
+
+	llmProviders, err := llmProvidersFromConfig(ctx, next, currentProviders)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the tools are named again for the new providers. the previous names are still resolved by the sessions in progress.
+	names.SetRule(ruleOf(next))
+
+	acl.Apply(next.Access)
+	stale, err := pool.Apply(ctx, next.MCPServers)
+	if err != nil {
+		// required servers that failed to start are retried on the next reload
+		slog.ErrorContext(ctx, "failed to apply mcp servers", slog.String("error", err.Error()))
 	}
-	closer := func() error {
-		for name, client := range clients {
-			if err := client.Close(); err != nil {
-				return errors.Wrap(err, fmt.Sprintf("failed to close mcp client: %s", name))
+	stale = append(stale, userPool.Apply(ctx, next.MCPServers)...)
+	wait := uc.Swap(llmProviders[next.LLM()], llmProviders, pool.Clients())
+	go func() {
+		wait()
+		for _, c := range stale {
+			if err := c.Close(); err != nil {
+				slog.Warn("failed to close mcp client", slog.String("error", err.Error()))
 			}
 		}
-		return nil
-	}
-	return clients, closer, nil
+	}()
+	slog.InfoContext(ctx, "config reloaded")
+	return next, llmProviders, nil
 }
 
-// llmToolsFromMCPClient converts mcp.Tool to llm.Tool
-func llmToolsFromMCPClient(ctx context.Context, mcpClient client.MCPClient, mcpServerName string) ([]llm.Tool, error) {
-	toolsResult, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
-	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf("failed to list tools: %s", mcpServerName))
+// restartRequired returns the keys of the changed fields that cannot be applied without restart.
+func restartRequired(current, next *config.Config) []string {
+	var changed []string
+	if current.TimeoutNs != next.TimeoutNs {
+		changed = append(changed, "timeoutNs")
+	}
+	if current.SlackBotToken != next.SlackBotToken {
+		changed = append(changed, "slackBotToken")
+	}
+	if current.SackSinginSecret != next.SackSinginSecret {
+		changed = append(changed, "slackSigninSecret")
 	}
-	llmTools := make([]llm.Tool, 0, len(toolsResult.Tools))
-	for _, tool := range toolsResult.Tools {
-		namespacedName := fmt.Sprintf("%s__%s", mcpServerName, tool.Name)
-		llmTools = append(llmTools, llm.Tool{
-			Name:        namespacedName,
-			Description: tool.Description,
-			InputSchema: llm.Schema{
-				Type:       tool.InputSchema.Type,
-				Properties: tool.InputSchema.Properties,
-				Required:   tool.InputSchema.Required,
-			},
-		})
+	if !slices.Equal(current.AllowedUsers, next.AllowedUsers) {
+		changed = append(changed, "allowedUsers")
 	}
-	return llmTools, nil
+	if current.Port != next.Port {
+		changed = append(changed, "port")
+	}
+	if current.GCPProjectId != next.GCPProjectId {
+		changed = append(changed, "gcpProjectId")
+	}
+	if current.PublicURL != next.PublicURL {
+		changed = append(changed, "publicUrl")
+	}
+	return changed
 }
 
-const (
-	llmProviderAnthropic = "anthropic"
-	llmProviderOpenAI    = "openai"
-	llmProviderGoogle    = "google"
-)
+// ruleOf returns the rule of the tool names accepted by all LLM providers of the top-level settings and the channel profiles.
+func ruleOf(cfg *config.Config) toolname.Rule {
+	var providers []string
+	for _, settings := range cfg.LLMConfigs() {
+		providers = append(providers, settings.ProviderName)
+	}
+	return toolname.RuleOf(providers...)
+}
 
-// llmProviderFromConfig creates an LLM provider from the given configuration.
-func llmProviderFromConfig(ctx context.Context, cfg Config) (llm.Provider, error) {
-	slog.DebugContext(ctx, "llmProviderFromConfig", slog.String("provider", cfg.LLMProviderName), slog.String("baseURL", cfg.LLMBaseURL), slog.String("modelName", cfg.LLMModelName))
-	switch cfg.LLMProviderName {
-	case llmProviderAnthropic:
-		return anthropic.NewProvider(cfg.LLMApiKey, cfg.LLMBaseURL, cfg.LLMModelName, ""), nil
-	case llmProviderOpenAI:
-		return openai.NewProvider(cfg.LLMApiKey, cfg.LLMBaseURL, cfg.LLMModelName, ""), nil
-	case llmProviderGoogle:
-		return google.NewProvider(ctx, cfg.LLMApiKey, cfg.LLMModelName, "")
-	default:
-		return nil, fmt.Errorf("unsupported LLM provider: %s", cfg.LLMProviderName)
+// llmProvidersFromConfig creates the LLM providers of the top-level settings and the channel profiles keyed by their settings.
+// the providers in current are reused if their settings are unchanged.
+func llmProvidersFromConfig(ctx context.Context, cfg *config.Config, current map[config.LLMConfig]llm.Provider) (map[config.LLMConfig]llm.Provider, error) {
+	providers := make(map[config.LLMConfig]llm.Provider)
+	for _, settings := range cfg.LLMConfigs() {
+		if llmProvider, ok := current[settings]; ok {
+			providers[settings] = llmProvider
+			continue
+		}
+		llmProvider, err := llmprovider.New(ctx, settings)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to create llm provider: %s", settings.ProviderName))
+		}
+		providers[settings] = llmProvider
 	}
+	return providers, nil
 }
@@ -0,0 +1,154 @@
+package access
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+)
+
+const (
+	// groupMembersTTL is the time to cache the members of the Slack user groups.
+	groupMembersTTL = 5 * time.Minute
+	// groupMembersRetryInterval is the time to wait before listing the members again after it fails.
+	groupMembersRetryInterval = 30 * time.Second
+)
+
+// UserGroups is an interface that lists the members of the Slack user groups.
+type UserGroups interface {
+	GetUserGroupMembersContext(ctx context.Context, userGroup string) ([]string, error)
+}
+
+// Control grants the tools of the MCP servers to the Slack users by their roles. safe for concurrent use.
+type Control struct {
+	groups UserGroups
+
+	mu     sync.RWMutex
+	config *config.AccessConfig
+
+	membersMu sync.Mutex
+	// members are the members of the user groups keyed by the group ID.
+	members map[string]groupMembers
+}
+
+// groupMembers is the cached members of a user group.
+type groupMembers struct {
+	// users are nil if the members have never been listed.
+	users     map[string]bool
+	expiresAt time.Time
+}
+
+// New returns a new instance of Control.
+//
+//   - cfg: The configuration of the access control. all users can use all tools if nil.
+//   - groups: Lists the members of the user groups the roles are mapped from.
+func New(cfg *config.AccessConfig, groups UserGroups) *Control {
+	return &Control{
+		groups:  groups,
+		config:  cfg,
+		members: make(map[string]groupMembers),
+	}
+}
+
+// Apply replaces the configuration, such as on reload. the calls in progress are checked with the previous one.
+func (c *Control) Apply(cfg *config.AccessConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = cfg
+}
+
+// Allows reports whether the user can use the tool of the MCP server.
+// the user is denied if the members of the groups cannot be listed.
+//
+//   - user: The Slack user ID.
+//   - server: The name of the MCP server.
+//   - tool: The name of the tool on the server, not the alias.
+func (c *Control) Allows(ctx context.Context, user, server, tool string) bool {
+	return c.allows(ctx, user, func(policy config.PolicyConfig) bool {
+		return policy.Grants(server, tool)
+	})
+}
+
+// AllowsServer reports whether the user can use any tool of the MCP server, such as to use its prompts.
+//
+//   - user: The Slack user ID.
+//   - server: The name of the MCP server.
+func (c *Control) AllowsServer(ctx context.Context, user, server string) bool {
+	return c.allows(ctx, user, func(policy config.PolicyConfig) bool {
+		return policy.GrantsServer(server)
+	})
+}
+
+// allows reports whether any policy granting as grants is granted to the user.
+func (c *Control) allows(ctx context.Context, user string, grants func(policy config.PolicyConfig) bool) bool {
+	c.mu.RLock()
+	cfg := c.config
+	c.mu.RUnlock()
+	if cfg == nil {
+		return true
+	}
+	for _, policy := range cfg.Policies {
+		if !grants(policy) {
+			continue
+		}
+		for _, role := range policy.Roles {
+			if role == config.AnyRole || c.hasRole(ctx, cfg.Roles[role], user) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasRole reports whether the user has the role, directly or as a member of its groups.
+func (c *Control) hasRole(ctx context.Context, role config.RoleConfig, user string) bool {
+	if slices.Contains(role.Users, user) {
+		return true
+	}
+	for _, group := range role.Groups {
+		if c.membersOf(ctx, group)[user] {
+			return true
+		}
+	}
+	return false
+}
+
+// membersOf returns the members of the user group, listed again after groupMembersTTL.
+// the previous members are used if they cannot be listed again, and the failed listing is retried after groupMembersRetryInterval.
+// returns nil if the members have never been listed.
+// the lock is not held while listing, so that a slow listing does not block the other checks.
+func (c *Control) membersOf(ctx context.Context, group string) map[string]bool {
+	c.membersMu.Lock()
+	cached, ok := c.members[group]
+	c.membersMu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.users
+	}
+
+	users, err := c.groups.GetUserGroupMembersContext(ctx, group)
+	if err != nil {
+		slog.Warn("failed to list members of user group. the previous members are used if any",
+			slog.String("group", group), slog.String("error", err.Error()))
+		c.membersMu.Lock()
+		defer c.membersMu.Unlock()
+		// the members may have been listed by another check in the meantime
+		cached = c.members[group]
+		if time.Now().Before(cached.expiresAt) {
+			return cached.users
+		}
+		cached.expiresAt = time.Now().Add(groupMembersRetryInterval)
+		c.members[group] = cached
+		return cached.users
+	}
+	members := groupMembers{users: make(map[string]bool, len(users)), expiresAt: time.Now().Add(groupMembersTTL)}
+	for _, user := range users {
+		members.users[user] = true
+	}
+	c.membersMu.Lock()
+	defer c.membersMu.Unlock()
+	c.members[group] = members
+	return members.users
+}
@@ -0,0 +1,237 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+)
+
+// fakeUserGroups is UserGroups listing the members of the groups.
+type fakeUserGroups struct {
+	mu      sync.Mutex
+	members map[string][]string
+	// failing are the groups whose members cannot be listed.
+	failing map[string]bool
+	// blocking are the groups whose listing waits until the channel is closed.
+	blocking map[string]chan struct{}
+	calls    map[string]int
+}
+
+func (g *fakeUserGroups) GetUserGroupMembersContext(ctx context.Context, userGroup string) ([]string, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]int)
+	}
+	g.calls[userGroup]++
+	block := g.blocking[userGroup]
+	failing := g.failing[userGroup]
+	members := g.members[userGroup]
+	g.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	if failing {
+		return nil, errors.New("failed")
+	}
+	return members, nil
+}
+
+func (g *fakeUserGroups) setFailing(group string, failing bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.failing == nil {
+		g.failing = make(map[string]bool)
+	}
+	g.failing[group] = failing
+}
+
+func (g *fakeUserGroups) callsOf(group string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.calls[group]
+}
+
+// testAccess is the configuration granting the tools of the servers to the roles.
+var testAccess = &config.AccessConfig{
+	Roles: map[string]config.RoleConfig{
+		"admin":     {Users: []string{"U_ADMIN"}},
+		"developer": {Groups: []string{"S_DEV"}},
+		"broken":    {Groups: []string{"S_BROKEN"}},
+	},
+	Policies: []config.PolicyConfig{
+		{Roles: []string{"admin"}, Servers: []string{"*"}},
+		{Roles: []string{"developer"}, Servers: []string{"github"}, Tools: []string{"get_*", "list_*"}},
+		{Roles: []string{"broken"}, Servers: []string{"jira"}},
+		{Roles: []string{config.AnyRole}, Servers: []string{"fetch"}},
+	},
+}
+
+func TestControl_Allows(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    *config.AccessConfig
+		user   string
+		server string
+		tool   string
+		want   bool
+	}{
+		{name: "no access config", cfg: nil, user: "U_ANY", server: "github", tool: "delete_repo", want: true},
+		{name: "user of role", cfg: testAccess, user: "U_ADMIN", server: "github", tool: "delete_repo", want: true},
+		{name: "member of group", cfg: testAccess, user: "U_DEV", server: "github", tool: "get_issue", want: true},
+		{name: "member of group without the tool", cfg: testAccess, user: "U_DEV", server: "github", tool: "delete_repo", want: false},
+		{name: "member of group without the server", cfg: testAccess, user: "U_DEV", server: "slack", tool: "get_channel", want: false},
+		{name: "any role", cfg: testAccess, user: "U_ANY", server: "fetch", tool: "fetch", want: true},
+		{name: "no role", cfg: testAccess, user: "U_ANY", server: "github", tool: "get_issue", want: false},
+		{name: "members cannot be listed", cfg: testAccess, user: "U_DEV", server: "jira", tool: "get_issue", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := &fakeUserGroups{
+				members: map[string][]string{"S_DEV": {"U_DEV"}, "S_BROKEN": {"U_DEV"}},
+				failing: map[string]bool{"S_BROKEN": true},
+			}
+			c := New(tt.cfg, groups)
+			if got := c.Allows(context.Background(), tt.user, tt.server, tt.tool); got != tt.want {
+				t.Errorf("Allows(%q, %q, %q) = %v, want %v", tt.user, tt.server, tt.tool, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestControl_AllowsServer(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   string
+		server string
+		want   bool
+	}{
+		{name: "user of role", user: "U_ADMIN", server: "jira", want: true},
+		{name: "member of group granted some tools", user: "U_DEV", server: "github", want: true},
+		{name: "member of group without the server", user: "U_DEV", server: "slack", want: false},
+		{name: "any role", user: "U_ANY", server: "fetch", want: true},
+		{name: "no role", user: "U_ANY", server: "github", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(testAccess, &fakeUserGroups{members: map[string][]string{"S_DEV": {"U_DEV"}}})
+			if got := c.AllowsServer(context.Background(), tt.user, tt.server); got != tt.want {
+				t.Errorf("AllowsServer(%q, %q) = %v, want %v", tt.user, tt.server, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestControl_Apply(t *testing.T) {
+	c := New(testAccess, &fakeUserGroups{})
+	if c.Allows(context.Background(), "U_ANY", "github", "get_issue") {
+		t.Fatal("Allows() = true before Apply, want false")
+	}
+	c.Apply(nil)
+	if !c.Allows(context.Background(), "U_ANY", "github", "get_issue") {
+		t.Error("Allows() = false after Apply(nil), want true")
+	}
+}
+
+func TestControl_MembersOf(t *testing.T) {
+	groups := &fakeUserGroups{members: map[string][]string{"S_DEV": {"U_DEV"}}}
+	c := New(testAccess, groups)
+	ctx := context.Background()
+	expire := func() {
+		c.membersMu.Lock()
+		defer c.membersMu.Unlock()
+		cached := c.members["S_DEV"]
+		cached.expiresAt = time.Now().Add(-time.Second)
+		c.members["S_DEV"] = cached
+	}
+
+	tests := []struct {
+		name string
+		// before is run before checking the member.
+		before    func()
+		want      bool
+		wantCalls int
+	}{
+		{name: "listed at first", want: true, wantCalls: 1},
+		{name: "cached", want: true, wantCalls: 1},
+		{name: "listed again after expired", before: expire, want: true, wantCalls: 2},
+		{
+			name: "previous members used if listing fails",
+			before: func() {
+				expire()
+				groups.setFailing("S_DEV", true)
+			},
+			want:      true,
+			wantCalls: 3,
+		},
+		{name: "failed listing not retried until retry interval", want: true, wantCalls: 3},
+		{
+			name: "listed again after retry interval",
+			before: func() {
+				expire()
+				groups.setFailing("S_DEV", false)
+			},
+			want:      true,
+			wantCalls: 4,
+		},
+	}
+	for _, tt := range tests {
+		if tt.before != nil {
+			tt.before()
+		}
+		if got := c.Allows(ctx, "U_DEV", "github", "get_issue"); got != tt.want {
+			t.Errorf("%s: Allows() = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := groups.callsOf("S_DEV"); got != tt.wantCalls {
+			t.Errorf("%s: listed %d times, want %d", tt.name, got, tt.wantCalls)
+		}
+	}
+}
+
+func TestControl_MembersOf_NotBlockedBySlowListing(t *testing.T) {
+	block := make(chan struct{})
+	groups := &fakeUserGroups{
+		members:  map[string][]string{"S_DEV": {"U_DEV"}, "S_SLOW": {"U_SLOW"}},
+		blocking: map[string]chan struct{}{"S_SLOW": block},
+	}
+	cfg := &config.AccessConfig{
+		Roles: map[string]config.RoleConfig{
+			"developer": {Groups: []string{"S_DEV"}},
+			"slow":      {Groups: []string{"S_SLOW"}},
+		},
+		Policies: []config.PolicyConfig{
+			{Roles: []string{"slow"}, Servers: []string{"jira"}},
+			{Roles: []string{"developer"}, Servers: []string{"github"}},
+		},
+	}
+	c := New(cfg, groups)
+
+	slow := make(chan bool)
+	go func() {
+		slow <- c.Allows(context.Background(), "U_SLOW", "jira", "get_issue")
+	}()
+	for groups.callsOf("S_SLOW") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan bool)
+	go func() {
+		done <- c.Allows(context.Background(), "U_DEV", "github", "get_issue")
+	}()
+	select {
+	case got := <-done:
+		if !got {
+			t.Error("Allows() = false, want true")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Allows() is blocked by the listing of another group")
+	}
+
+	close(block)
+	if !<-slow {
+		t.Error("Allows() of the slow group = false, want true")
+	}
+}
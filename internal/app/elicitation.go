@@ -0,0 +1,352 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/goccy/go-json"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackutilsx"
+)
+
+var (
+	ErrElicitationNoSession = errors.New("elicitation request must be made during a tool call")
+)
+
+const (
+	// elicitationTimeout is the time to wait for the user to answer the elicitation request.
+	elicitationTimeout = 10 * time.Minute
+	// maxElicitationFields is the maximum number of the inputs in a form, limited by the blocks of a Slack message.
+	maxElicitationFields = 45
+)
+
+// elicitationSchema is the restricted JSON schema of the requested input, whose properties are primitive values.
+type elicitationSchema struct {
+	Properties map[string]elicitationProperty `json:"properties"`
+	Required   []string                       `json:"required"`
+}
+
+// elicitationProperty is a property of elicitationSchema.
+type elicitationProperty struct {
+	Type        string   `json:"type"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Format      string   `json:"format"`
+	Enum        []string `json:"enum"`
+	EnumNames   []string `json:"enumNames"`
+	Default     any      `json:"default"`
+	MinLength   *int     `json:"minLength"`
+	MaxLength   *int     `json:"maxLength"`
+	Minimum     *float64 `json:"minimum"`
+	Maximum     *float64 `json:"maximum"`
+}
+
+// Elicit asks the user for the input requested by the MCP server with a form posted in the thread.
+// the request is attributed to the tool call in progress to the server it belongs to, whose timeout is suspended until the user answers.
+// the request is cancelled if the user does not answer within elicitationTimeout or the session is done.
+//
+//   - c: The client connected to the server, which the request is attributed to.
+//   - server: The name of the server.
+func (u *UseCase) Elicit(ctx context.Context, c client.MCPClient, server string, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	slog.Info("BEGIN UseCase.Elicit", slog.String("server", server))
+	defer slog.Info("END UseCase.Elicit", slog.String("server", server))
+
+	call, err := u.toolCallOf(c, request.Params.Meta)
+	if err != nil {
+		return nil, err
+	}
+	if call == nil {
+		return nil, ErrElicitationNoSession
+	}
+	ctx, done := call.attach(ctx)
+	defer done()
+
+	schema, fields, err := parseElicitationSchema(request.Params.RequestedSchema)
+	if err != nil {
+		return nil, err
+	}
+	id, actions, release, err := u.newInteraction(call.user, func(action string, values map[string]string) error {
+		if action != string(mcp.ElicitationResponseActionAccept) {
+			return nil
+		}
+		_, err := schema.content(fields, values)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	text := fmt.Sprintf("<@%s> \n📝 `%s` asks:\n>>> %s", call.user, server, slackutilsx.EscapeMessage(request.Params.Message))
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+	}
+	for _, name := range fields {
+		blocks = append(blocks, schema.inputBlock(name))
+	}
+	blocks = append(blocks, slack.NewActionBlock(
+		id,
+		slack.NewButtonBlockElement(string(mcp.ElicitationResponseActionAccept), "", slack.NewTextBlockObject(slack.PlainTextType, "Submit", false, false)).
+			WithStyle(slack.StylePrimary),
+		slack.NewButtonBlockElement(string(mcp.ElicitationResponseActionDecline), "", slack.NewTextBlockObject(slack.PlainTextType, "Decline", false, false)).
+			WithStyle(slack.StyleDanger),
+		slack.NewButtonBlockElement(string(mcp.ElicitationResponseActionCancel), "", slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false)),
+	))
+	messageID, err := func() (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, u.timeoutNs)
+		defer cancel()
+		_, v, err := u.slackClient.PostMessageContext(
+			ctx,
+			call.channel,
+			slack.MsgOptionText(text, false),
+			slack.MsgOptionBlocks(blocks...),
+			slack.MsgOptionTS(call.threadTs))
+		return v, err
+	}()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to post elicitation form")
+	}
+
+	result := &mcp.ElicitationResult{}
+	var status string
+	timer := time.NewTimer(elicitationTimeout)
+	defer timer.Stop()
+	select {
+	case action := <-actions:
+		result.Action = mcp.ElicitationResponseAction(action.id)
+		switch result.Action {
+		case mcp.ElicitationResponseActionAccept:
+			// the values are already validated on the action
+			result.Content, _ = schema.content(fields, action.values)
+			status = fmt.Sprintf("✅ Submitted by <@%s>", call.user)
+		case mcp.ElicitationResponseActionDecline:
+			status = fmt.Sprintf("🚫 Declined by <@%s>", call.user)
+		default:
+			result.Action = mcp.ElicitationResponseActionCancel
+			status = fmt.Sprintf("⏹️ Cancelled by <@%s>", call.user)
+		}
+	case <-timer.C:
+		result.Action = mcp.ElicitationResponseActionCancel
+		status = "⌛ Expired"
+	case <-ctx.Done():
+		result.Action = mcp.ElicitationResponseActionCancel
+		status = "⌛ Cancelled"
+	}
+
+	// the form is replaced with the result even if the session is done
+	updateCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), u.timeoutNs)
+	defer cancel()
+	_, _, _, err = u.slackClient.UpdateMessageContext(
+		updateCtx,
+		call.channel,
+		messageID,
+		slack.MsgOptionText(fmt.Sprintf("%s\n%s", text, status), false),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+			slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, status, false, false)),
+		))
+	if err != nil {
+		slog.Warn("failed to update elicitation form", slog.String("error", err.Error()))
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return result, nil
+}
+
+// parseElicitationSchema parses the requested schema, and returns the names of its properties in the order of the form.
+// the required properties come first in the order of required, as the order of the properties is not kept, then the others by name.
+func parseElicitationSchema(requestedSchema any) (*elicitationSchema, []string, error) {
+	b, err := json.Marshal(requestedSchema)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to marshal requested schema")
+	}
+	var schema elicitationSchema
+	if err := json.Unmarshal(b, &schema); err != nil {
+		return nil, nil, errors.Wrap(err, "invalid requested schema")
+	}
+	if len(schema.Properties) > maxElicitationFields {
+		return nil, nil, errors.New(fmt.Sprintf("too many properties in requested schema: %d. must be at most %d", len(schema.Properties), maxElicitationFields))
+	}
+	fields := make([]string, 0, len(schema.Properties))
+	for _, name := range schema.Required {
+		if _, ok := schema.Properties[name]; ok && !slices.Contains(fields, name) {
+			fields = append(fields, name)
+		}
+	}
+	var optional []string
+	for name, property := range schema.Properties {
+		switch property.Type {
+		case "string", "number", "integer", "boolean":
+		default:
+			return nil, nil, errors.New(fmt.Sprintf("unsupported type of property %s: %s", name, property.Type))
+		}
+		if !slices.Contains(fields, name) {
+			optional = append(optional, name)
+		}
+	}
+	slices.Sort(optional)
+	return &schema, append(fields, optional...), nil
+}
+
+// inputBlock returns the input of the form for the property, whose block ID and action ID are the name of the property.
+func (s *elicitationSchema) inputBlock(name string) *slack.InputBlock {
+	property := s.Properties[name]
+	label := property.Title
+	if label == "" {
+		label = name
+	}
+	var element slack.BlockElement
+	switch {
+	case len(property.Enum) > 0:
+		options := make([]*slack.OptionBlockObject, 0, len(property.Enum))
+		var initial *slack.OptionBlockObject
+		for i, value := range property.Enum {
+			text := value
+			if i < len(property.EnumNames) {
+				text = property.EnumNames[i]
+			}
+			option := slack.NewOptionBlockObject(value, slack.NewTextBlockObject(slack.PlainTextType, text, false, false), nil)
+			if property.Default == value {
+				initial = option
+			}
+			options = append(options, option)
+		}
+		e := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, nil, name, options...)
+		e.InitialOption = initial
+		element = e
+	case property.Type == "boolean":
+		option := slack.NewOptionBlockObject("true", slack.NewTextBlockObject(slack.PlainTextType, label, false, false), nil)
+		e := slack.NewCheckboxGroupsBlockElement(name, option)
+		if property.Default == true {
+			e.InitialOptions = []*slack.OptionBlockObject{option}
+		}
+		element = e
+	case property.Type == "number" || property.Type == "integer":
+		e := slack.NewNumberInputBlockElement(nil, name, property.Type == "number")
+		if property.Minimum != nil {
+			e.MinValue = strconv.FormatFloat(*property.Minimum, 'f', -1, 64)
+		}
+		if property.Maximum != nil {
+			e.MaxValue = strconv.FormatFloat(*property.Maximum, 'f', -1, 64)
+		}
+		if v, ok := property.Default.(float64); ok {
+			e.InitialValue = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		element = e
+	case property.Format == "email":
+		e := slack.NewEmailTextInputBlockElement(nil, name)
+		e.InitialValue, _ = property.Default.(string)
+		element = e
+	case property.Format == "uri":
+		e := slack.NewURLTextInputBlockElement(nil, name)
+		e.InitialValue, _ = property.Default.(string)
+		element = e
+	case property.Format == "date":
+		e := slack.NewDatePickerBlockElement(name)
+		e.InitialDate, _ = property.Default.(string)
+		element = e
+	case property.Format == "date-time":
+		e := slack.NewDateTimePickerBlockElement(name)
+		if v, ok := property.Default.(string); ok {
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				e.InitialDateTime = t.Unix()
+			}
+		}
+		element = e
+	default:
+		e := slack.NewPlainTextInputBlockElement(nil, name)
+		e.InitialValue, _ = property.Default.(string)
+		if property.MinLength != nil {
+			e.MinLength = *property.MinLength
+		}
+		if property.MaxLength != nil {
+			e.MaxLength = *property.MaxLength
+		}
+		element = e
+	}
+	var hint *slack.TextBlockObject
+	if property.Description != "" {
+		hint = slack.NewTextBlockObject(slack.PlainTextType, property.Description, false, false)
+	}
+	block := slack.NewInputBlock(name, slack.NewTextBlockObject(slack.PlainTextType, label, false, false), hint, element)
+	// the checkbox is unchecked for false
+	block.Optional = property.Type == "boolean" || !slices.Contains(s.Required, name)
+	return block
+}
+
+// content converts the values of the form to the content conforming to the schema.
+// returns error to show the user if the values are invalid.
+func (s *elicitationSchema) content(fields []string, values map[string]string) (map[string]any, error) {
+	content := make(map[string]any, len(fields))
+	var problems []string
+	for _, name := range fields {
+		property := s.Properties[name]
+		label := property.Title
+		if label == "" {
+			label = name
+		}
+		value := values[name]
+		if property.Type == "boolean" {
+			content[name] = value == "true"
+			continue
+		}
+		if value == "" {
+			if slices.Contains(s.Required, name) {
+				problems = append(problems, fmt.Sprintf("%s is required", label))
+			}
+			continue
+		}
+		switch property.Type {
+		case "number", "integer":
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil || (property.Type == "integer" && v != float64(int64(v))) {
+				problems = append(problems, fmt.Sprintf("%s must be %s", label, property.Type))
+				continue
+			}
+			if property.Minimum != nil && v < *property.Minimum {
+				problems = append(problems, fmt.Sprintf("%s must be at least %v", label, *property.Minimum))
+				continue
+			}
+			if property.Maximum != nil && v > *property.Maximum {
+				problems = append(problems, fmt.Sprintf("%s must be at most %v", label, *property.Maximum))
+				continue
+			}
+			if property.Type == "integer" {
+				content[name] = int64(v)
+			} else {
+				content[name] = v
+			}
+		default:
+			if property.Format == "date-time" {
+				// the date time picker answers unix time
+				if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+					value = time.Unix(sec, 0).UTC().Format(time.RFC3339)
+				}
+			}
+			n := utf8.RuneCountInString(value)
+			if property.MinLength != nil && n < *property.MinLength {
+				problems = append(problems, fmt.Sprintf("%s must be at least %d characters", label, *property.MinLength))
+				continue
+			}
+			if property.MaxLength != nil && n > *property.MaxLength {
+				problems = append(problems, fmt.Sprintf("%s must be at most %d characters", label, *property.MaxLength))
+				continue
+			}
+			content[name] = value
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "\n"))
+	}
+	return content, nil
+}
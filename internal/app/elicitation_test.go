@@ -0,0 +1,226 @@
+package app
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+// testSchema is the requested schema with a property of each type.
+var testSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"priority": map[string]any{
+			"type":      "string",
+			"title":     "Priority",
+			"enum":      []any{"low", "high"},
+			"enumNames": []any{"Low", "High"},
+			"default":   "high",
+		},
+		"notify": map[string]any{
+			"type":    "boolean",
+			"title":   "Notify",
+			"default": true,
+		},
+		"ratio": map[string]any{
+			"type":    "number",
+			"minimum": 0,
+			"maximum": 1,
+			"default": 0.5,
+		},
+		"count": map[string]any{
+			"type":    "integer",
+			"minimum": 1,
+		},
+		"title": map[string]any{
+			"type":        "string",
+			"description": "The title of the issue",
+			"maxLength":   10,
+		},
+	},
+	"required": []any{"title", "priority", "notify", "count"},
+}
+
+func TestParseElicitationSchema(t *testing.T) {
+	_, fields, err := parseElicitationSchema(testSchema)
+	if err != nil {
+		t.Fatalf("parseElicitationSchema() error = %v", err)
+	}
+	// the required properties in the order of required, then the others by name
+	want := []string{"title", "priority", "notify", "count", "ratio"}
+	if !slices.Equal(fields, want) {
+		t.Errorf("parseElicitationSchema() fields = %v, want %v", fields, want)
+	}
+
+	unsupported := map[string]any{
+		"properties": map[string]any{"nested": map[string]any{"type": "object"}},
+	}
+	if _, _, err := parseElicitationSchema(unsupported); err == nil {
+		t.Error("parseElicitationSchema() error = nil, want unsupported type")
+	}
+}
+
+func TestElicitationSchema_InputBlock(t *testing.T) {
+	schema, _, err := parseElicitationSchema(testSchema)
+	if err != nil {
+		t.Fatalf("parseElicitationSchema() error = %v", err)
+	}
+	tests := []struct {
+		name         string
+		wantType     slack.MessageElementType
+		wantLabel    string
+		wantOptional bool
+		check        func(t *testing.T, element slack.BlockElement)
+	}{
+		{
+			name:      "priority",
+			wantType:  slack.MessageElementType(slack.OptTypeStatic),
+			wantLabel: "Priority",
+			check: func(t *testing.T, element slack.BlockElement) {
+				e := element.(*slack.SelectBlockElement)
+				var values, texts []string
+				for _, option := range e.Options {
+					values = append(values, option.Value)
+					texts = append(texts, option.Text.Text)
+				}
+				if !slices.Equal(values, []string{"low", "high"}) || !slices.Equal(texts, []string{"Low", "High"}) {
+					t.Errorf("options = %v, %v, want the enum and its names", values, texts)
+				}
+				if e.InitialOption == nil || e.InitialOption.Value != "high" {
+					t.Errorf("initial option = %+v, want high", e.InitialOption)
+				}
+			},
+		},
+		{
+			name:      "notify",
+			wantType:  slack.METCheckboxGroups,
+			wantLabel: "Notify",
+			// the checkbox is unchecked for false, even if required
+			wantOptional: true,
+			check: func(t *testing.T, element slack.BlockElement) {
+				e := element.(*slack.CheckboxGroupsBlockElement)
+				if len(e.Options) != 1 || e.Options[0].Value != "true" {
+					t.Errorf("options = %+v, want the single option of true", e.Options)
+				}
+				if len(e.InitialOptions) != 1 {
+					t.Errorf("initial options = %+v, want checked by default", e.InitialOptions)
+				}
+			},
+		},
+		{
+			name:         "ratio",
+			wantType:     slack.METNumber,
+			wantLabel:    "ratio",
+			wantOptional: true,
+			check: func(t *testing.T, element slack.BlockElement) {
+				e := element.(*slack.NumberInputBlockElement)
+				if !e.IsDecimalAllowed || e.MinValue != "0" || e.MaxValue != "1" || e.InitialValue != "0.5" {
+					t.Errorf("number input = %+v, want decimal between 0 and 1 with 0.5", e)
+				}
+			},
+		},
+		{
+			name:      "count",
+			wantType:  slack.METNumber,
+			wantLabel: "count",
+			check: func(t *testing.T, element slack.BlockElement) {
+				e := element.(*slack.NumberInputBlockElement)
+				if e.IsDecimalAllowed || e.MinValue != "1" || e.MaxValue != "" {
+					t.Errorf("number input = %+v, want integer at least 1", e)
+				}
+			},
+		},
+		{
+			name:      "title",
+			wantType:  slack.METPlainTextInput,
+			wantLabel: "title",
+			check: func(t *testing.T, element slack.BlockElement) {
+				e := element.(*slack.PlainTextInputBlockElement)
+				if e.MaxLength != 10 {
+					t.Errorf("max length = %d, want 10", e.MaxLength)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := schema.inputBlock(tt.name)
+			if block.BlockID != tt.name {
+				t.Errorf("block ID = %q, want %q", block.BlockID, tt.name)
+			}
+			if block.Label.Text != tt.wantLabel {
+				t.Errorf("label = %q, want %q", block.Label.Text, tt.wantLabel)
+			}
+			if block.Optional != tt.wantOptional {
+				t.Errorf("optional = %v, want %v", block.Optional, tt.wantOptional)
+			}
+			if got := block.Element.ElementType(); got != tt.wantType {
+				t.Fatalf("element type = %q, want %q", got, tt.wantType)
+			}
+			tt.check(t, block.Element)
+		})
+	}
+}
+
+func TestElicitationSchema_Content(t *testing.T) {
+	schema, fields, err := parseElicitationSchema(testSchema)
+	if err != nil {
+		t.Fatalf("parseElicitationSchema() error = %v", err)
+	}
+	tests := []struct {
+		name   string
+		values map[string]string
+		want   map[string]any
+		// wantProblems are the problems shown to the user.
+		wantProblems []string
+	}{
+		{
+			name:   "all values",
+			values: map[string]string{"title": "bug", "priority": "low", "notify": "true", "count": "3", "ratio": "0.25"},
+			want:   map[string]any{"title": "bug", "priority": "low", "notify": true, "count": int64(3), "ratio": 0.25},
+		},
+		{
+			name:   "unchecked boolean and omitted optional number",
+			values: map[string]string{"title": "bug", "priority": "high", "count": "1"},
+			want:   map[string]any{"title": "bug", "priority": "high", "notify": false, "count": int64(1)},
+		},
+		{
+			name:         "missing required",
+			values:       map[string]string{"notify": "true"},
+			wantProblems: []string{"title is required", "Priority is required", "count is required"},
+		},
+		{
+			name:         "invalid numbers",
+			values:       map[string]string{"title": "bug", "priority": "low", "count": "1.5", "ratio": "2"},
+			wantProblems: []string{"count must be integer", "ratio must be at most 1"},
+		},
+		{
+			name:         "out of range",
+			values:       map[string]string{"title": "a long title", "priority": "low", "count": "0"},
+			wantProblems: []string{"title must be at most 10 characters", "count must be at least 1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := schema.content(fields, tt.values)
+			if len(tt.wantProblems) > 0 {
+				if err == nil {
+					t.Fatalf("content() = %v, want problems %v", got, tt.wantProblems)
+				}
+				if problems := strings.Split(err.Error(), "\n"); !slices.Equal(problems, tt.wantProblems) {
+					t.Errorf("content() problems = %q, want %q", problems, tt.wantProblems)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("content() error = %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("content() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
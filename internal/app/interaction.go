@@ -0,0 +1,341 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+)
+
+var (
+	ErrInteractionExpired = errors.New("this request is expired or already answered")
+	ErrAmbiguousToolCall  = errors.New("request cannot be attributed to a tool call, since the calls of other sessions are in progress")
+)
+
+const (
+	// approvalTimeout is the time to wait for the user to approve the request.
+	approvalTimeout = 5 * time.Minute
+	actionApprove   = "approve"
+	actionDeny      = "deny"
+)
+
+// interaction is a pending interactive message waiting for the action of the user.
+type interaction struct {
+	user string
+	// validate checks the values of the inputs on the action. the invalid action is not delivered, and the user can retry.
+	validate func(action string, values map[string]string) error
+	actions  chan interactionAction
+}
+
+// interactionAction is the action of the user on the interactive message.
+type interactionAction struct {
+	id string
+	// values are the values of the inputs in the message keyed by their block ID.
+	values map[string]string
+}
+
+// newInteraction registers a pending interaction answered only by the user.
+// the returned id must be set to the block ID of the actions, so that the action can be routed by HandleAction.
+// the caller must call done when the interaction is no longer waited.
+//
+//   - validate: Checks the values of the inputs on the action. nil accepts any values.
+func (u *UseCase) newInteraction(user string, validate func(action string, values map[string]string) error) (id string, actions <-chan interactionAction, done func(), err error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, nil, errors.Wrap(err, "failed to generate interaction id")
+	}
+	id = hex.EncodeToString(b)
+	i := &interaction{
+		user:     user,
+		validate: validate,
+		actions:  make(chan interactionAction, 1),
+	}
+	u.interactions.Store(id, i)
+	return id, i.actions, func() { u.interactions.Delete(id) }, nil
+}
+
+// HandleAction delivers the action of the user on the interactive message to the pending interaction.
+// returns error to show the user if the interaction is expired, the user is not the requester, or the values are invalid.
+//
+//   - id: The block ID of the actions, which identifies the pending interaction.
+//   - user: The Slack user ID who clicks the button.
+//   - action: The action ID of the button.
+//   - values: The values of the inputs in the message keyed by their block ID.
+func (u *UseCase) HandleAction(ctx context.Context, id, user, action string, values map[string]string) error {
+	v, ok := u.interactions.Load(id)
+	if !ok {
+		return ErrInteractionExpired
+	}
+	i := v.(*interaction)
+	if i.user != user {
+		return errors.New(fmt.Sprintf("only <@%s> can answer this request", i.user))
+	}
+	if i.validate != nil {
+		if err := i.validate(action, values); err != nil {
+			return err
+		}
+	}
+	select {
+	case i.actions <- interactionAction{id: action, values: values}:
+		u.interactions.Delete(id)
+		return nil
+	default:
+		return ErrInteractionExpired
+	}
+}
+
+// askApproval posts the request with Approve and Deny buttons in the thread, and waits for the user to click one of them.
+// the request is denied if the user does not answer within approvalTimeout or ctx is done.
+//
+//   - user: The Slack user ID who can answer the request.
+//   - text: The description of the request.
+func (u *UseCase) askApproval(ctx context.Context, user, channel, threadTs, text string) (bool, error) {
+	id, actions, done, err := u.newInteraction(user, nil)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+
+	text = fmt.Sprintf("<@%s> \n%s", user, text)
+	messageID, err := func() (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, u.timeoutNs)
+		defer cancel()
+		_, v, err := u.slackClient.PostMessageContext(
+			ctx,
+			channel,
+			slack.MsgOptionText(text, false),
+			slack.MsgOptionBlocks(
+				slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+				slack.NewActionBlock(
+					id,
+					slack.NewButtonBlockElement(actionApprove, actionApprove, slack.NewTextBlockObject(slack.PlainTextType, "Approve", false, false)).
+						WithStyle(slack.StylePrimary),
+					slack.NewButtonBlockElement(actionDeny, actionDeny, slack.NewTextBlockObject(slack.PlainTextType, "Deny", false, false)).
+						WithStyle(slack.StyleDanger),
+				)),
+			slack.MsgOptionTS(threadTs))
+		return v, err
+	}()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to post approval request")
+	}
+
+	var (
+		approved bool
+		result   string
+	)
+	timer := time.NewTimer(approvalTimeout)
+	defer timer.Stop()
+	select {
+	case action := <-actions:
+		approved = action.id == actionApprove
+		if approved {
+			result = fmt.Sprintf("✅ Approved by <@%s>", user)
+		} else {
+			result = fmt.Sprintf("🚫 Denied by <@%s>", user)
+		}
+	case <-timer.C:
+		result = "⌛ Expired"
+	case <-ctx.Done():
+		result = "⌛ Cancelled"
+	}
+
+	// the buttons are replaced with the result even if the session is done
+	updateCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), u.timeoutNs)
+	defer cancel()
+	_, _, _, err = u.slackClient.UpdateMessageContext(
+		updateCtx,
+		channel,
+		messageID,
+		slack.MsgOptionText(fmt.Sprintf("%s\n%s", text, result), false),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+			slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, result, false, false)),
+		))
+	if err != nil {
+		slog.Warn("failed to update approval request", slog.String("error", err.Error()))
+	}
+	return approved, nil
+}
+
+// toolCall is a tool call in progress. the requests from the server during the call are attributed to it.
+type toolCall struct {
+	ctx      context.Context
+	name     string
+	user     string
+	channel  string
+	threadTs string
+	// profile is the profile of the channel of the session, which selects the LLM provider for the sampling requests.
+	profile config.Profile
+	// token is the progress token of the call.
+	token  string
+	status *statusMessage
+
+	mu        sync.Mutex
+	timeout   time.Duration
+	timer     *time.Timer
+	suspended int
+	progress  string
+	log       string
+}
+
+// beginToolCall registers the tool call to the server connected with c.
+// ctx of the returned toolCall is cancelled after timeout unless the timeout is suspended.
+// the caller must call end when the call finishes.
+//
+//   - name: The name of the tool shown in the status message.
+//   - status: The status message showing the progress of the call.
+//   - profile: The profile of the channel of the session.
+func (u *UseCase) beginToolCall(sessionCtx context.Context, c client.MCPClient, name string, status *statusMessage, profile config.Profile, user, channel, threadTs string) (call *toolCall, end func()) {
+	ctx, cancel := context.WithCancel(sessionCtx)
+	call = &toolCall{
+		ctx:      ctx,
+		name:     name,
+		user:     user,
+		channel:  channel,
+		threadTs: threadTs,
+		profile:  profile,
+		token:    strconv.FormatInt(u.progressTokens.Add(1), 10),
+		status:   status,
+		timeout:  u.timeoutNs,
+		timer:    time.AfterFunc(u.timeoutNs, cancel),
+	}
+	u.toolCallsMu.Lock()
+	u.toolCalls[c] = append(u.toolCalls[c], call)
+	u.toolCallsMu.Unlock()
+	call.showStatus()
+	return call, func() {
+		call.timer.Stop()
+		cancel()
+		u.toolCallsMu.Lock()
+		defer u.toolCallsMu.Unlock()
+		calls := u.toolCalls[c]
+		for i, v := range calls {
+			if v == call {
+				calls = append(calls[:i:i], calls[i+1:]...)
+				break
+			}
+		}
+		if len(calls) == 0 {
+			delete(u.toolCalls, c)
+		} else {
+			u.toolCalls[c] = calls
+		}
+	}
+}
+
+// toolCallByToken returns the tool call in progress to the server connected with c by its progress token.
+func (u *UseCase) toolCallByToken(c client.MCPClient, token string) (*toolCall, bool) {
+	u.toolCallsMu.Lock()
+	defer u.toolCallsMu.Unlock()
+	for _, call := range u.toolCalls[c] {
+		if call.token == token {
+			return call, true
+		}
+	}
+	return nil, false
+}
+
+// toolCallOf returns the tool call in progress to the server connected with c, which the request from the server belongs to.
+// the call is identified by the progress token in meta if any.
+// otherwise, the server cannot tell which call its request belongs to, so the request is attributed to the latest call
+// only if all calls in progress are of the same session, and ErrAmbiguousToolCall is returned if not.
+// returns nil without error if no calls are in progress.
+//
+//   - meta: The metadata of the request. nil if the request has none.
+func (u *UseCase) toolCallOf(c client.MCPClient, meta *mcp.Meta) (*toolCall, error) {
+	u.toolCallsMu.Lock()
+	defer u.toolCallsMu.Unlock()
+	calls := u.toolCalls[c]
+	if meta != nil && meta.ProgressToken != nil {
+		token := fmt.Sprint(meta.ProgressToken)
+		for _, call := range calls {
+			if call.token == token {
+				return call, nil
+			}
+		}
+	}
+	if len(calls) == 0 {
+		return nil, nil
+	}
+	latest := calls[len(calls)-1]
+	for _, call := range calls {
+		if !call.sameSession(latest) {
+			return nil, ErrAmbiguousToolCall
+		}
+	}
+	return latest, nil
+}
+
+// sameSession reports whether the calls are made by the same user in the same thread.
+func (t *toolCall) sameSession(other *toolCall) bool {
+	return t.user == other.user && t.channel == other.channel && t.threadTs == other.threadTs
+}
+
+// ChannelOf returns the Slack channel ID of the tool call in progress to the server connected with c,
+// identified by the progress token of the request.
+func (u *UseCase) ChannelOf(c client.MCPClient, request mcp.CallToolRequest) (string, bool) {
+	if request.Params.Meta == nil {
+		return "", false
+	}
+	call, ok := u.toolCallByToken(c, fmt.Sprint(request.Params.Meta.ProgressToken))
+	if !ok {
+		return "", false
+	}
+	return call.channel, true
+}
+
+// showStatus shows the tool, its progress and the latest log message in the status message.
+func (t *toolCall) showStatus() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	text := fmt.Sprintf("🔧 `%s`", t.name)
+	if t.progress != "" {
+		text = fmt.Sprintf("%s %s", text, t.progress)
+	}
+	text += "…"
+	if t.log != "" {
+		text = fmt.Sprintf("%s\n> %s", text, t.log)
+	}
+	t.status.set(text)
+}
+
+// attach attributes the request from the server to the call until done is called.
+// the timeout of the call is suspended, and the returned ctx is cancelled with the call.
+func (t *toolCall) attach(ctx context.Context) (context.Context, func()) {
+	resume := t.suspendTimeout()
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(t.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+		resume()
+	}
+}
+
+// suspendTimeout stops counting the timeout of the call, while the host handles the request from the server.
+// the timeout restarts from the beginning on resume.
+func (t *toolCall) suspendTimeout() (resume func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.suspended++
+	t.timer.Stop()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.suspended--
+		if t.suspended == 0 && t.ctx.Err() == nil {
+			t.timer.Reset(t.timeout)
+		}
+	}
+}
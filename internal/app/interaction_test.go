@@ -0,0 +1,50 @@
+package app
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestUseCase_ToolCallOf(t *testing.T) {
+	var c client.MCPClient = &client.Client{}
+	alice := &toolCall{token: "1", user: "U_ALICE", channel: "C1", threadTs: "1.0"}
+	aliceAgain := &toolCall{token: "2", user: "U_ALICE", channel: "C1", threadTs: "1.0"}
+	aliceOtherThread := &toolCall{token: "3", user: "U_ALICE", channel: "C1", threadTs: "2.0"}
+	bob := &toolCall{token: "4", user: "U_BOB", channel: "C1", threadTs: "3.0"}
+
+	tests := []struct {
+		name    string
+		calls   []*toolCall
+		meta    *mcp.Meta
+		want    *toolCall
+		wantErr error
+	}{
+		{name: "no calls", calls: nil, want: nil},
+		{name: "single call", calls: []*toolCall{alice}, want: alice},
+		{name: "calls of same session", calls: []*toolCall{alice, aliceAgain}, want: aliceAgain},
+		{name: "calls of different users", calls: []*toolCall{alice, bob}, wantErr: ErrAmbiguousToolCall},
+		{name: "calls of different threads", calls: []*toolCall{alice, aliceOtherThread}, wantErr: ErrAmbiguousToolCall},
+		{name: "progress token", calls: []*toolCall{alice, bob}, meta: &mcp.Meta{ProgressToken: "1"}, want: alice},
+		{name: "numeric progress token", calls: []*toolCall{alice, bob}, meta: &mcp.Meta{ProgressToken: 4}, want: bob},
+		{name: "unknown progress token", calls: []*toolCall{alice, bob}, meta: &mcp.Meta{ProgressToken: "9"}, wantErr: ErrAmbiguousToolCall},
+		{name: "meta without progress token", calls: []*toolCall{alice}, meta: &mcp.Meta{}, want: alice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &UseCase{toolCalls: map[client.MCPClient][]*toolCall{}}
+			if tt.calls != nil {
+				u.toolCalls[c] = tt.calls
+			}
+			got, err := u.toolCallOf(c, tt.meta)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("toolCallOf() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("toolCallOf() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
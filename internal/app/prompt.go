@@ -0,0 +1,177 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcphost/pkg/history"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack/slackutilsx"
+)
+
+// ListPrompts returns the prompts of the MCP servers available to the user keyed by server name.
+// the servers that do not publish prompts, not offered in the channel or not granted to the user are omitted.
+//
+//   - profile: The profile of the channel, which offers a subset of the servers.
+//   - user: The Slack user ID who runs the command.
+//   - channel: The Slack channel ID where the command is run.
+func (u *UseCase) ListPrompts(ctx context.Context, profile config.Profile, user, channel string) map[string][]mcp.Prompt {
+	deps, release := u.acquire()
+	defer release()
+	tools := u.toolSet(ctx, deps, profile, user, channel, "")
+
+	prompts := make(map[string][]mcp.Prompt)
+	for name, mcpClient := range tools.mcpClients {
+		if !tools.allowsPrompts(name) {
+			continue
+		}
+		result, err := func() (*mcp.ListPromptsResult, error) {
+			ctx, cancel := context.WithTimeout(ctx, u.timeoutNs)
+			defer cancel()
+			return mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+		}()
+		if err != nil {
+			// servers without the prompts capability respond with an error
+			slog.Debug("failed to list prompts", slog.String("server", name), slog.String("error", err.Error()))
+			continue
+		}
+		if len(result.Prompts) == 0 {
+			continue
+		}
+		prompts[name] = result.Prompts
+	}
+	return prompts
+}
+
+// ExecutePrompt fetches the prompt of the MCP server, and runs its messages through the LLM in a new thread.
+// returns error without posting to the channel if the prompt cannot be fetched.
+//
+//   - sessionCtx: context representing the session for the operation.
+//   - profile: The profile of the channel, which selects the LLM provider and the tools of the session.
+//   - user: The Slack user ID who runs the command.
+//   - channel: The Slack channel ID where the thread will be started.
+//   - server: The name of the MCP server publishing the prompt.
+//   - name: The name of the prompt.
+//   - arguments: The arguments to fill the prompt template.
+func (u *UseCase) ExecutePrompt(sessionCtx context.Context, profile config.Profile, user, channel, server, name string, arguments map[string]string) error {
+	slog.Info("BEGIN UseCase.ExecutePrompt", slog.String("channel", channel), slog.String("server", server), slog.String("name", name))
+	defer slog.Info("END UseCase.ExecutePrompt", slog.String("channel", channel))
+
+	deps, release := u.acquire()
+	defer release()
+	tools := u.toolSet(sessionCtx, deps, profile, user, channel, "")
+	if !tools.allowsPrompts(server) {
+		return errors.New(fmt.Sprintf("not allowed to use the prompts of mcp server: %s", server))
+	}
+	mcpClient, ok := tools.mcpClients[server]
+	if !ok {
+		return errors.New(fmt.Sprintf("mcp server not found: %s", server))
+	}
+
+	result, err := func() (*mcp.GetPromptResult, error) {
+		ctx, cancel := context.WithTimeout(sessionCtx, u.timeoutNs)
+		defer cancel()
+		listResult, err := mcpClient.ListPrompts(ctx, mcp.ListPromptsRequest{})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to list prompts: %s", server))
+		}
+		i := slices.IndexFunc(listResult.Prompts, func(p mcp.Prompt) bool {
+			return p.Name == name
+		})
+		if i == -1 {
+			return nil, errors.New(fmt.Sprintf("prompt not found: %s %s", server, name))
+		}
+		var missing []string
+		for _, arg := range listResult.Prompts[i].Arguments {
+			if _, ok := arguments[arg.Name]; arg.Required && !ok {
+				missing = append(missing, arg.Name)
+			}
+		}
+		if len(missing) > 0 {
+			return nil, errors.New(fmt.Sprintf("missing required arguments: %s", strings.Join(missing, ", ")))
+		}
+		req := mcp.GetPromptRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = arguments
+		return mcpClient.GetPrompt(ctx, req)
+	}()
+	if err != nil {
+		return err
+	}
+	messages := historyFromPrompt(result.Messages)
+	if len(messages) == 0 {
+		return errors.New(fmt.Sprintf("prompt has no messages: %s %s", server, name))
+	}
+
+	threadTs, err := u.postMessage(sessionCtx, user, channel, promptCommand(server, name, arguments), "")
+	if err != nil {
+		return err
+	}
+	sessionCtx, stopID, done, err := u.stoppable(sessionCtx, user, channel, threadTs)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return u.execute(sessionCtx, deps.llmProviderOf(profile), tools, user, channel, threadTs, stopID, "", messages)
+}
+
+// promptCommand returns the text describing the prompt run by the user, posted as the root of the thread.
+func promptCommand(server, name string, arguments map[string]string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "▶️ `%s` prompt of `%s`", name, server)
+	keys := make([]string, 0, len(arguments))
+	for k := range arguments {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\n• %s: %s", k, slackutilsx.EscapeMessage(arguments[k]))
+	}
+	return b.String()
+}
+
+// historyFromPrompt converts the messages of the prompt to the history messages sent to the LLM.
+// images and audio are not passed to the LLM, but only described.
+func historyFromPrompt(promptMessages []mcp.PromptMessage) []history.HistoryMessage {
+	messages := make([]history.HistoryMessage, 0, len(promptMessages))
+	for _, pm := range promptMessages {
+		var text string
+		switch content := pm.Content.(type) {
+		case mcp.TextContent:
+			text = content.Text
+		case mcp.ImageContent:
+			text = fmt.Sprintf("[image (%s)]", content.MIMEType)
+		case mcp.AudioContent:
+			text = fmt.Sprintf("[audio (%s)]", content.MIMEType)
+		case mcp.EmbeddedResource:
+			switch resource := content.Resource.(type) {
+			case mcp.TextResourceContents:
+				text = fmt.Sprintf("%s\n%s", resource.URI, resource.Text)
+			case mcp.BlobResourceContents:
+				text = fmt.Sprintf("[binary resource %s (%s)]", resource.URI, resource.MIMEType)
+			}
+		}
+		if text == "" {
+			continue
+		}
+		block := history.ContentBlock{
+			Type: "text",
+			Text: text,
+		}
+		// merge the consecutive messages of the same role, as some providers require the roles to alternate
+		if len(messages) > 0 && messages[len(messages)-1].Role == string(pm.Role) {
+			messages[len(messages)-1].Content = append(messages[len(messages)-1].Content, block)
+			continue
+		}
+		messages = append(messages, history.HistoryMessage{
+			Role:    string(pm.Role),
+			Content: []history.ContentBlock{block},
+		})
+	}
+	return messages
+}
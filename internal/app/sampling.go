@@ -0,0 +1,130 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcphost/pkg/history"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack/slackutilsx"
+)
+
+var (
+	ErrSamplingDenied    = errors.New("sampling request was denied by the user")
+	ErrSamplingNoSession = errors.New("sampling request must be made during a tool call to be approved")
+)
+
+// errSamplingUnsupported is returned when the LLM provider cannot generate the messages for the sampling requests.
+var errSamplingUnsupported = errors.New("LLM provider does not support sampling")
+
+// samplingPreviewLength is the maximum length of the messages shown to the user on approval.
+const samplingPreviewLength = 500
+
+// CreateMessage samples a message from the LLM for the sampling request from the MCP server.
+// the request is attributed to the tool call in progress to the server, whose timeout is suspended until the message is sampled.
+// the request is refused if it may belong to the calls of other sessions.
+// the message is generated by the LLM provider of the channel of the call with the system prompt of the request, up to request.MaxTokens tokens.
+//
+//   - c: The client connected to the server, which the request is attributed to.
+//   - server: The name of the server.
+//   - approval: Whether the request must be approved in the thread by the user who calls the tool.
+func (u *UseCase) CreateMessage(ctx context.Context, c client.MCPClient, server string, approval bool, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	slog.Info("BEGIN UseCase.CreateMessage", slog.String("server", server), slog.Bool("approval", approval))
+	defer slog.Info("END UseCase.CreateMessage", slog.String("server", server))
+
+	messages := historyFromSampling(request.Messages)
+	if len(messages) == 0 {
+		return nil, errors.New("sampling request has no messages")
+	}
+
+	// the sampling requests have no metadata to identify the call
+	call, err := u.toolCallOf(c, nil)
+	if err != nil {
+		return nil, err
+	}
+	if call != nil {
+		var done func()
+		ctx, done = call.attach(ctx)
+		defer done()
+	}
+	if approval {
+		if call == nil {
+			return nil, ErrSamplingNoSession
+		}
+		approved, err := u.askApproval(ctx, call.user, call.channel, call.threadTs, samplingApprovalText(server, request))
+		if err != nil {
+			return nil, err
+		}
+		if !approved {
+			return nil, ErrSamplingDenied
+		}
+	}
+
+	deps, release := u.acquire()
+	defer release()
+	var profile config.Profile
+	if call != nil {
+		profile = call.profile
+	}
+	llmProvider := deps.llmProviderOf(profile)
+	samplingProvider, ok := llmProvider.(SamplingProvider)
+	if !ok {
+		return nil, errSamplingUnsupported
+	}
+	text, err := func() (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, u.timeoutNs)
+		defer cancel()
+		return samplingProvider.Sample(ctx, request.SystemPrompt, messages, request.MaxTokens)
+	}()
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to sample message: %s", server))
+	}
+	return &mcp.CreateMessageResult{
+		SamplingMessage: mcp.SamplingMessage{
+			Role:    mcp.RoleAssistant,
+			Content: mcp.NewTextContent(text),
+		},
+		Model:      llmProvider.Name(),
+		StopReason: "endTurn",
+	}, nil
+}
+
+// samplingApprovalText returns the text asking the user to approve the sampling request.
+func samplingApprovalText(server string, request mcp.CreateMessageRequest) string {
+	var preview string
+	for i := len(request.Messages) - 1; i >= 0; i-- {
+		if content, ok := request.Messages[i].Content.(mcp.TextContent); ok {
+			preview = content.Text
+			break
+		}
+	}
+	if r := []rune(preview); len(r) > samplingPreviewLength {
+		preview = string(r[:samplingPreviewLength]) + "…"
+	}
+	text := fmt.Sprintf("🧠 `%s` requests to use the LLM (up to %d tokens).", server, request.MaxTokens)
+	if preview != "" {
+		text = fmt.Sprintf("%s\n>>> %s", text, slackutilsx.EscapeMessage(preview))
+	}
+	return text
+}
+
+// historyFromSampling converts the messages of the sampling request to the history messages sent to the LLM.
+// images and audio are not passed to the LLM, but only described.
+func historyFromSampling(samplingMessages []mcp.SamplingMessage) []history.HistoryMessage {
+	promptMessages := make([]mcp.PromptMessage, 0, len(samplingMessages))
+	for _, sm := range samplingMessages {
+		content, ok := sm.Content.(mcp.Content)
+		if !ok {
+			continue
+		}
+		promptMessages = append(promptMessages, mcp.PromptMessage{
+			Role:    sm.Role,
+			Content: content,
+		})
+	}
+	return historyFromPrompt(promptMessages)
+}
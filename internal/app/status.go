@@ -0,0 +1,177 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/slack-go/slack/slackutilsx"
+)
+
+const (
+	// statusInterval is the minimum interval to update the status message, to respect the rate limits of Slack.
+	statusInterval = 2 * time.Second
+	// maxStatusLogLength is the maximum length of the log message shown in the status message.
+	maxStatusLogLength = 200
+)
+
+// statusMessage is the message showing the status of the tool calls in the thread.
+// the updates are throttled to at most once per statusInterval, and only the latest text is shown.
+type statusMessage struct {
+	u        *UseCase
+	ctx      context.Context
+	user     string
+	channel  string
+	threadTs string
+	stopID   string
+
+	mu sync.Mutex
+	// text is the latest text to show.
+	text string
+	// pending is true while the update is scheduled or in progress.
+	pending    bool
+	closed     bool
+	lastUpdate time.Time
+
+	// flushMu serializes the requests to Slack.
+	flushMu sync.Mutex
+	// id is the timestamp of the message, empty until posted.
+	id    string
+	shown string
+}
+
+// newStatusMessage returns the status message in the thread.
+//
+//   - id: The timestamp of the message to reuse, such as the placeholder. if empty, the message is posted on the first update.
+//   - stopID: The ID of the Stop button of the session shown in the message.
+func (u *UseCase) newStatusMessage(ctx context.Context, user, channel, threadTs, id, stopID string) *statusMessage {
+	s := &statusMessage{
+		u:        u,
+		ctx:      ctx,
+		user:     user,
+		channel:  channel,
+		threadTs: threadTs,
+		stopID:   stopID,
+		id:       id,
+	}
+	if id == "" {
+		// the new message is not posted for the calls finishing within statusInterval
+		s.lastUpdate = time.Now()
+	}
+	return s
+}
+
+// set updates the text of the message. it does not block, as it is called from the notification handlers.
+func (s *statusMessage) set(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.text = text
+	if s.pending {
+		return
+	}
+	s.pending = true
+	time.AfterFunc(max(0, statusInterval-time.Since(s.lastUpdate)), s.flush)
+}
+
+// flush shows the latest text, and schedules the next update if the text is changed meanwhile.
+func (s *statusMessage) flush() {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	s.mu.Lock()
+	text, closed := s.text, s.closed
+	s.mu.Unlock()
+	if !closed && text != s.shown {
+		var err error
+		if s.id == "" {
+			s.id, err = s.u.postMessage(s.ctx, s.user, s.channel, text, s.threadTs, stopBlocks(s.user, text, s.stopID)...)
+		} else {
+			s.id, err = s.u.updateMessage(s.ctx, s.user, s.channel, s.id, text, stopBlocks(s.user, text, s.stopID)...)
+		}
+		if err != nil {
+			slog.Warn("failed to update status message", slog.String("error", err.Error()))
+		}
+		s.shown = text
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastUpdate = time.Now()
+	s.pending = false
+	if !s.closed && s.text != s.shown {
+		s.pending = true
+		time.AfterFunc(statusInterval, s.flush)
+	}
+}
+
+// close stops the updates and deletes the message, even if the session is stopped.
+func (s *statusMessage) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	if s.id != "" {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(s.ctx), s.u.timeoutNs)
+		defer cancel()
+		s.u.slackClient.DeleteMessageContext(ctx, s.channel, s.id)
+	}
+}
+
+// OnProgress shows the progress notified by the MCP server in the status message of the tool call with the progress token.
+func (u *UseCase) OnProgress(c client.MCPClient, server string, params mcp.ProgressNotificationParams) {
+	call, ok := u.toolCallByToken(c, fmt.Sprint(params.ProgressToken))
+	if !ok {
+		slog.Debug("progress of unknown request", slog.String("server", server), slog.Any("token", params.ProgressToken))
+		return
+	}
+	var progress string
+	if params.Total > 0 {
+		progress = fmt.Sprintf("%d%%", int(params.Progress/params.Total*100))
+	} else {
+		progress = fmt.Sprintf("%v", params.Progress)
+	}
+	if params.Message != "" {
+		progress = fmt.Sprintf("%s %s", progress, slackutilsx.EscapeMessage(params.Message))
+	}
+	call.mu.Lock()
+	call.progress = progress
+	call.mu.Unlock()
+	call.showStatus()
+}
+
+// OnLog shows the log message sent by the MCP server in the status message of the tool call to the server it belongs to.
+func (u *UseCase) OnLog(c client.MCPClient, server string, params mcp.LoggingMessageNotificationParams) {
+	data, ok := params.Data.(string)
+	if !ok {
+		b, err := json.Marshal(params.Data)
+		if err != nil {
+			return
+		}
+		data = string(b)
+	}
+	slog.Info("mcp server log",
+		slog.String("server", server),
+		slog.String("level", string(params.Level)),
+		slog.String("logger", params.Logger),
+		slog.String("data", data))
+	// the log message is not shown if it may belong to the call of another session
+	call, err := u.toolCallOf(c, nil)
+	if call == nil || err != nil {
+		return
+	}
+	if r := []rune(data); len(r) > maxStatusLogLength {
+		data = string(r[:maxStatusLogLength]) + "…"
+	}
+	call.mu.Lock()
+	call.log = fmt.Sprintf("[%s] %s", params.Level, slackutilsx.EscapeMessage(data))
+	call.mu.Unlock()
+	call.showStatus()
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+)
+
+var (
+	ErrStopped = errors.New("stopped by the user")
+	ErrNoRun   = errors.New("no session is running in the thread")
+)
+
+const (
+	actionStop = "stop"
+	// stoppedText is the note posted in the thread when the session is stopped.
+	stoppedText = "⏹️ Stopped"
+)
+
+// stoppable registers the session in the thread to be stopped by the user,
+// with the Stop button of the messages or Stop.
+// the returned ctx is cancelled with ErrStopped when the user stops the session.
+// the caller must call done when the session finishes.
+//
+//   - user: The Slack user ID who can stop the session.
+//   - threadTs: The timestamp of the thread, which identifies the session to Stop.
+func (u *UseCase) stoppable(sessionCtx context.Context, user, channel, threadTs string) (ctx context.Context, stopID string, done func(), err error) {
+	stopID, actions, doneInteraction, err := u.newInteraction(user, nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	ctx, cancel := context.WithCancelCause(sessionCtx)
+	key := fmt.Sprintf("%s#%s", channel, threadTs)
+	u.runs.Store(key, stopID)
+	go func() {
+		select {
+		case <-actions:
+			slog.Info("session is stopped", slog.String("channel", channel), slog.String("threadTs", threadTs), slog.String("user", user))
+			cancel(ErrStopped)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, stopID, func() {
+		u.runs.CompareAndDelete(key, stopID)
+		doneInteraction()
+		cancel(nil)
+	}, nil
+}
+
+// Stop stops the session in the thread, as the Stop button does.
+// returns ErrNoRun if no session is running in the thread, or error if the user is not the one who starts it.
+//
+//   - user: The Slack user ID who stops the session.
+//   - channel: The Slack channel ID of the thread.
+//   - threadTs: The timestamp of the thread.
+func (u *UseCase) Stop(ctx context.Context, user, channel, threadTs string) error {
+	stopID, ok := u.runs.Load(fmt.Sprintf("%s#%s", channel, threadTs))
+	if !ok {
+		return ErrNoRun
+	}
+	return u.HandleAction(ctx, stopID.(string), user, actionStop, nil)
+}
+
+// stopped reports whether the session is stopped by the user.
+func stopped(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrStopped)
+}
+
+// stopBlocks returns the blocks of the message with the Stop button of the session, or nil if stopID is empty.
+//
+//   - message: The text of the message, formatted as postMessage does.
+func stopBlocks(user, message, stopID string) []slack.Block {
+	if stopID == "" {
+		return nil
+	}
+	return []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("<@%s> \n%s", user, message), false, false), nil, nil),
+		slack.NewActionBlock(
+			stopID,
+			slack.NewButtonBlockElement(actionStop, actionStop, slack.NewTextBlockObject(slack.PlainTextType, "Stop", false, false)).
+				WithStyle(slack.StyleDanger),
+		),
+	}
+}
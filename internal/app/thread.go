@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcphost/pkg/history"
+	"github.com/pkg/errors"
+	"github.com/slack-go/slack"
+)
+
+// threadRepliesLimit is the number of the messages of the thread fetched at once.
+const threadRepliesLimit = 200
+
+// leadingMention matches the mention at the beginning of the message,
+// such as the bot mentioned by the user, or the user the bot replies to.
+var leadingMention = regexp.MustCompile(`^<@[A-Z0-9]+>\s*`)
+
+// botNotes are the beginnings of the messages of the bot other than the answers of the LLM,
+// such as the notes of the stopped or failed sessions, the errors of the requests, and the links of the accounts.
+var botNotes = []string{
+	stoppedText,
+	failedText,
+	"🫵 Unauthorized",
+	"⛔ You are not allowed",
+	"🙌 You have reached your rate limit",
+	"⚠️ Occured unexpected error",
+	"🔗 <",
+}
+
+// threadHistory returns the earlier messages of the thread as the conversation history, the newest ones within the token budget.
+// the messages of the bot are the turns of the assistant, and the others are the turns of the user.
+// the interactions and the notes of the bot, such as the approvals and the status of the session, are left out.
+// returns nil if the messages cannot be fetched, such as when the scopes are missing.
+//
+//   - ts: The timestamp of the mention, which is left out with the later messages.
+//   - maxTokens: The budget of the estimated tokens of the history.
+func (u *UseCase) threadHistory(ctx context.Context, channel, ts string, maxTokens int) []history.HistoryMessage {
+	replies, err := u.threadReplies(ctx, channel, ts)
+	if err != nil {
+		slog.Warn("failed to fetch thread history", slog.String("channel", channel), slog.String("ts", ts), slog.String("error", err.Error()))
+		return nil
+	}
+
+	type turn struct {
+		role string
+		text string
+	}
+	turns := make([]turn, 0, len(replies))
+	for i, reply := range replies {
+		text := strings.TrimSpace(leadingMention.ReplaceAllString(reply.Text, ""))
+		if text == "" {
+			continue
+		}
+		role := "user"
+		// the root posted by the bot is the request of the user, such as the prompt run by the slash command
+		if i > 0 && reply.BotID != "" && reply.BotID == u.botID {
+			if isBotNote(reply, text) {
+				continue
+			}
+			role = "assistant"
+		}
+		turns = append(turns, turn{role: role, text: text})
+	}
+
+	start, tokens := len(turns), 0
+	for start > 0 {
+		tokens += estimateTokens(turns[start-1].text)
+		if tokens > maxTokens {
+			break
+		}
+		start--
+	}
+	// the conversation starts with the turn of the user
+	for start < len(turns) && turns[start].role != "user" {
+		start++
+	}
+	if start < len(turns) {
+		slog.Debug("thread history", slog.String("channel", channel), slog.String("ts", ts),
+			slog.Int("messages", len(turns)-start), slog.Int("omitted", start))
+	}
+
+	var messages []history.HistoryMessage
+	for _, t := range turns[start:] {
+		messages = appendTurn(messages, t.role, t.text)
+	}
+	return messages
+}
+
+// threadReplies returns the messages of the thread posted before the message of ts, the root first.
+func (u *UseCase) threadReplies(ctx context.Context, channel, ts string) ([]slack.Message, error) {
+	var (
+		replies []slack.Message
+		cursor  string
+	)
+	for {
+		msgs, hasMore, nextCursor, err := func() ([]slack.Message, bool, string, error) {
+			ctx, cancel := context.WithTimeout(ctx, u.timeoutNs)
+			defer cancel()
+			// ts of a reply also identifies the thread
+			return u.slackClient.GetConversationRepliesContext(ctx, &slack.GetConversationRepliesParameters{
+				ChannelID: channel,
+				Timestamp: ts,
+				Cursor:    cursor,
+				Limit:     threadRepliesLimit,
+			})
+		}()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to fetch conversation replies")
+		}
+		for _, msg := range msgs {
+			if msg.Timestamp == ts {
+				return replies, nil
+			}
+			replies = append(replies, msg)
+		}
+		if !hasMore || nextCursor == "" {
+			return replies, nil
+		}
+		cursor = nextCursor
+	}
+}
+
+// isBotNote reports whether the message of the bot is not an answer of the LLM.
+// the messages with the buttons, or the results of the buttons, are the interactions with the user,
+// such as the status with the Stop button, the approvals, and the elicitation forms.
+//
+//   - text: The text of the message without the leading mention.
+func isBotNote(msg slack.Message, text string) bool {
+	for _, block := range msg.Blocks.BlockSet {
+		switch block.BlockType() {
+		case slack.MBTAction, slack.MBTContext:
+			return true
+		}
+	}
+	for _, note := range botNotes {
+		if strings.HasPrefix(text, note) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendTurn appends the text to the conversation, joining it to the last message of the same role,
+// as some providers do not accept the consecutive messages of the same role.
+func appendTurn(messages []history.HistoryMessage, role, text string) []history.HistoryMessage {
+	if n := len(messages); n > 0 && messages[n-1].Role == role && len(messages[n-1].Content) == 1 && messages[n-1].Content[0].Type == "text" {
+		messages[n-1].Content[0].Text += "\n\n" + text
+		return messages
+	}
+	return append(messages, history.HistoryMessage{
+		Role: role,
+		Content: []history.ContentBlock{{
+			Type: "text",
+			Text: text,
+		}},
+	})
+}
+
+// estimateTokens returns the estimated number of the tokens of the text without the tokenizer of the provider,
+// about 4 ASCII characters and 1 other character per token.
+func estimateTokens(text string) int {
+	var ascii, others int
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			others++
+		}
+	}
+	return (ascii+3)/4 + others
+}
@@ -0,0 +1,222 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcphost/pkg/history"
+	"github.com/slack-go/slack"
+)
+
+// fakeSlackClient is SlackClient returning the replies of the thread in pages.
+type fakeSlackClient struct {
+	SlackClient
+	// pages are the replies returned for each cursor, the first for the empty cursor.
+	pages [][]slack.Message
+	err   error
+}
+
+func (c *fakeSlackClient) GetConversationRepliesContext(ctx context.Context, params *slack.GetConversationRepliesParameters) ([]slack.Message, bool, string, error) {
+	if c.err != nil {
+		return nil, false, "", c.err
+	}
+	page := 0
+	if params.Cursor != "" {
+		page = int(params.Cursor[0] - '0')
+	}
+	if page+1 < len(c.pages) {
+		return c.pages[page], true, string(rune('0' + page + 1)), nil
+	}
+	return c.pages[page], false, "", nil
+}
+
+const testBotID = "B0BOT"
+
+// userReply returns the message of the user.
+func userReply(ts, text string) slack.Message {
+	return slack.Message{Msg: slack.Msg{Timestamp: ts, User: "U0ALICE", Text: text}}
+}
+
+// botReply returns the message of the bot.
+func botReply(ts, text string, blocks ...slack.Block) slack.Message {
+	return slack.Message{Msg: slack.Msg{Timestamp: ts, BotID: testBotID, Text: text, Blocks: slack.Blocks{BlockSet: blocks}}}
+}
+
+// textTurn returns the history message of the role with the text.
+func textTurn(role, text string) history.HistoryMessage {
+	return history.HistoryMessage{Role: role, Content: []history.ContentBlock{{Type: "text", Text: text}}}
+}
+
+func TestUseCase_ThreadHistory(t *testing.T) {
+	mention := userReply("9.0", "<@U0BOT> and then?")
+	tests := []struct {
+		name      string
+		pages     [][]slack.Message
+		err       error
+		maxTokens int
+		want      []history.HistoryMessage
+	}{
+		{
+			name: "conversation",
+			pages: [][]slack.Message{{
+				userReply("1.0", "<@U0BOT> hello"),
+				botReply("2.0", "<@U0ALICE> \nhi"),
+				mention,
+				userReply("10.0", "later"),
+			}},
+			maxTokens: 100,
+			want:      []history.HistoryMessage{textTurn("user", "hello"), textTurn("assistant", "hi")},
+		},
+		{
+			name: "pages",
+			pages: [][]slack.Message{
+				{userReply("1.0", "<@U0BOT> hello")},
+				{botReply("2.0", "<@U0ALICE> \nhi"), mention},
+			},
+			maxTokens: 100,
+			want:      []history.HistoryMessage{textTurn("user", "hello"), textTurn("assistant", "hi")},
+		},
+		{
+			name: "root posted by bot",
+			pages: [][]slack.Message{{
+				botReply("1.0", "<@U0ALICE> \n/mcp github summarize"),
+				botReply("2.0", "<@U0ALICE> \nsummary"),
+				mention,
+			}},
+			maxTokens: 100,
+			want:      []history.HistoryMessage{textTurn("user", "/mcp github summarize"), textTurn("assistant", "summary")},
+		},
+		{
+			name: "notes of bot",
+			pages: [][]slack.Message{{
+				userReply("1.0", "<@U0BOT> hello"),
+				botReply("2.0", "<@U0ALICE> \n⌛ Thinking...", slack.NewActionBlock("", slack.NewButtonBlockElement(actionStop, "", slack.NewTextBlockObject(slack.PlainTextType, "Stop", false, false)))),
+				botReply("3.0", "⚠️ The model requests to call `github__delete_repo`.\n✅ Approved by <@U0ALICE>",
+					slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "⚠️ The model requests to call `github__delete_repo`.", false, false), nil, nil),
+					slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, "✅ Approved by <@U0ALICE>", false, false))),
+				botReply("4.0", "<@U0ALICE> \n"+stoppedText),
+				botReply("5.0", "<@U0ALICE> \n"+failedText),
+				botReply("6.0", "<@U0ALICE> \n⚠️ Occured unexpected error"),
+				botReply("7.0", "<@U0ALICE> \nhi"),
+				mention,
+			}},
+			maxTokens: 100,
+			want:      []history.HistoryMessage{textTurn("user", "hello"), textTurn("assistant", "hi")},
+		},
+		{
+			name: "messages of other bots",
+			pages: [][]slack.Message{{
+				userReply("1.0", "<@U0BOT> hello"),
+				{Msg: slack.Msg{Timestamp: "2.0", BotID: "B0OTHER", Text: "deployed"}},
+				mention,
+			}},
+			maxTokens: 100,
+			want:      []history.HistoryMessage{textTurn("user", "hello\n\ndeployed")},
+		},
+		{
+			name: "consecutive turns of user",
+			pages: [][]slack.Message{{
+				userReply("1.0", "<@U0BOT> hello"),
+				userReply("2.0", "are you there?"),
+				userReply("3.0", " "),
+				mention,
+			}},
+			maxTokens: 100,
+			want:      []history.HistoryMessage{textTurn("user", "hello\n\nare you there?")},
+		},
+		{
+			name: "over budget",
+			pages: [][]slack.Message{{
+				userReply("1.0", "<@U0BOT> "+strings.Repeat("a", 400)),
+				botReply("2.0", "<@U0ALICE> \nfirst answer"),
+				userReply("3.0", "question"),
+				botReply("4.0", "<@U0ALICE> \nsecond answer"),
+				mention,
+			}},
+			maxTokens: 10,
+			want:      []history.HistoryMessage{textTurn("user", "question"), textTurn("assistant", "second answer")},
+		},
+		{
+			name: "starting with assistant in budget",
+			pages: [][]slack.Message{{
+				userReply("1.0", "<@U0BOT> "+strings.Repeat("a", 400)),
+				botReply("2.0", "<@U0ALICE> \nfirst answer"),
+				mention,
+			}},
+			maxTokens: 10,
+			want:      nil,
+		},
+		{
+			name:      "first message",
+			pages:     [][]slack.Message{{mention}},
+			maxTokens: 100,
+			want:      nil,
+		},
+		{
+			name:      "fetch error",
+			err:       errors.New("missing_scope"),
+			maxTokens: 100,
+			want:      nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &UseCase{
+				slackClient: &fakeSlackClient{pages: tt.pages, err: tt.err},
+				botID:       testBotID,
+				timeoutNs:   time.Second,
+			}
+			got := u.threadHistory(context.Background(), "C1", mention.Timestamp, tt.maxTokens)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("threadHistory() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendTurn(t *testing.T) {
+	toolUse := history.HistoryMessage{Role: "assistant", Content: []history.ContentBlock{{Type: "tool_use", ID: "toolu_1"}}}
+	tests := []struct {
+		name     string
+		messages []history.HistoryMessage
+		role     string
+		want     []history.HistoryMessage
+	}{
+		{name: "first", role: "user", want: []history.HistoryMessage{textTurn("user", "text")}},
+		{name: "other role", messages: []history.HistoryMessage{textTurn("assistant", "a")}, role: "user", want: []history.HistoryMessage{textTurn("assistant", "a"), textTurn("user", "text")}},
+		{name: "same role", messages: []history.HistoryMessage{textTurn("user", "a")}, role: "user", want: []history.HistoryMessage{textTurn("user", "a\n\ntext")}},
+		{name: "same role with tool use", messages: []history.HistoryMessage{toolUse}, role: "assistant", want: []history.HistoryMessage{toolUse, textTurn("assistant", "text")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := appendTurn(tt.messages, tt.role, "text"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("appendTurn() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{text: "", want: 0},
+		{text: "a", want: 1},
+		{text: "abcd", want: 1},
+		{text: "abcde", want: 2},
+		{text: "こんにちは", want: 5},
+		{text: "hi こんにちは", want: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := estimateTokens(tt.text); got != tt.want {
+				t.Errorf("estimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"log/slog"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/avast/retry-go"
@@ -14,8 +16,10 @@ import (
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcphost/pkg/history"
 	"github.com/mark3labs/mcphost/pkg/llm"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
 	"github.com/pkg/errors"
 	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackutilsx"
 )
 
 var (
@@ -27,68 +31,298 @@ type SlackClient interface {
 	PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error)
 	UpdateMessageContext(ctx context.Context, channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error)
 	DeleteMessageContext(ctx context.Context, channel, messageTimestamp string) (string, string, error)
+	PostEphemeralContext(ctx context.Context, channelID, userID string, options ...slack.MsgOption) (string, error)
+	GetConversationRepliesContext(ctx context.Context, params *slack.GetConversationRepliesParameters) (msgs []slack.Message, hasMore bool, nextCursor string, err error)
 }
 
+// UserClients is an interface that provides the MCP clients connected with the Slack user's own account.
+type UserClients interface {
+	// Clients returns the MCP clients and tools for the user, and the names of the servers the user has not linked the account yet.
+	Clients(ctx context.Context, user string) (clients map[string]client.MCPClient, tools []llm.Tool, unlinked []string)
+	// LinkURL returns the URL for the user to link the account of the server, and the time it expires.
+	LinkURL(ctx context.Context, server, user string) (string, time.Time, error)
+}
+
+// ToolRegistry is an interface that provides the tools of the MCP servers.
+// the tools must be kept up to date as the servers add or remove them at runtime, and be safe for concurrent use.
+type ToolRegistry interface {
+	// Tools returns the current tools of all MCP servers.
+	Tools() []llm.Tool
+}
+
+// ToolNames is an interface that resolves the names of the tools sent to the LLM.
+type ToolNames interface {
+	// Resolve returns the MCP server and the name of the tool on the server. returns false if the name is unknown.
+	Resolve(name string) (server, tool string, ok bool)
+}
+
+// AccessControl is an interface that grants the tools of the MCP servers to the Slack users.
+type AccessControl interface {
+	// Allows reports whether the user can use the tool of the server.
+	Allows(ctx context.Context, user, server, tool string) bool
+	// AllowsServer reports whether the user can use any tool of the server.
+	AllowsServer(ctx context.Context, user, server string) bool
+}
+
+// ToolPolicy is implemented by the MCP clients restricting the tools of the server.
+type ToolPolicy interface {
+	// Allows reports whether the tool is offered to the LLM.
+	Allows(tool string) bool
+	// RequiresApproval reports whether the calls of the tool must be approved by the user.
+	RequiresApproval(tool string) bool
+}
+
+// SamplingProvider is implemented by the LLM providers generating the messages for the sampling requests from the MCP servers.
+type SamplingProvider interface {
+	// Sample generates the message following the messages with the system prompt of the request, up to maxTokens tokens.
+	Sample(ctx context.Context, systemPrompt string, messages []history.HistoryMessage, maxTokens int) (string, error)
+}
+
+// linkReminderInterval is the interval to remind the user to link the account of the same server.
+const linkReminderInterval = 24 * time.Hour
+
+// failedText is the answer shown when the LLM fails to answer.
+const failedText = "😵‍💫‍"
+
 // UseCase represents the use-case for handling Slack messages and LLM interactions.
 type UseCase struct {
 	timeoutNs   time.Duration
 	slackClient SlackClient
+	// botID is the bot ID of the Slack app, whose messages in the threads are the turns of the assistant.
+	botID       string
+	tools       ToolRegistry
+	toolNames   ToolNames
+	userClients UserClients
+	access      AccessControl
+	mu          sync.RWMutex
+	deps        *dependencies
+	// linkReminders is the time the user was last reminded to link the account, keyed by `<server>#<user>`.
+	linkReminders sync.Map
+	// interactions are the pending interactive messages keyed by the block ID of their actions.
+	interactions sync.Map
+	toolCallsMu  sync.Mutex
+	// toolCalls are the tool calls in progress keyed by the client connected to the server.
+	toolCalls map[client.MCPClient][]*toolCall
+	// progressTokens generates the progress tokens of the tool calls.
+	progressTokens atomic.Int64
+	// runs are the IDs of the Stop buttons of the sessions in progress keyed by `<channel>#<threadTs>`.
+	runs sync.Map
+}
+
+// dependencies represents the dependencies of UseCase that can be swapped at runtime.
+type dependencies struct {
 	llmProvider llm.Provider
-	tools       []llm.Tool
-	mcpClients  map[string]client.MCPClient
+	// llmProviders are the LLM providers of the channel profiles keyed by their settings.
+	llmProviders map[config.LLMConfig]llm.Provider
+	mcpClients   map[string]client.MCPClient
+	// inUse counts the sessions using the MCP clients.
+	inUse *sync.WaitGroup
+}
+
+// llmProviderOf returns the LLM provider of the profile, or the default one if the profile has no provider.
+func (d *dependencies) llmProviderOf(profile config.Profile) llm.Provider {
+	if llmProvider, ok := d.llmProviders[profile.LLM]; ok {
+		return llmProvider
+	}
+	return d.llmProvider
+}
+
+// toolSet represents the tools and MCP clients available in a session.
+type toolSet struct {
+	registry ToolRegistry
+	// userTools are the tools of the servers connected with the user's own account.
+	userTools  []llm.Tool
+	mcpClients map[string]client.MCPClient
+	names      ToolNames
+	// allows reports whether the user of the session can use the tool of the server.
+	allows func(server, tool string) bool
+	// allowsServer reports whether the user of the session can use any tool of the server.
+	allowsServer func(server string) bool
+	// profile is the profile of the channel, which offers a subset of the tools.
+	profile config.Profile
+}
+
+// llmTools returns the current tools available in the session, leaving out the ones the user cannot use or not offered in the channel.
+func (t toolSet) llmTools() []llm.Tool {
+	return slices.DeleteFunc(slices.Concat(t.registry.Tools(), t.userTools), func(tool llm.Tool) bool {
+		server, name, ok := t.names.Resolve(tool.Name)
+		return !ok || !t.profile.Offers(server, name) || !t.allows(server, name)
+	})
+}
+
+// allowsPrompts reports whether the user of the session can use the prompts of the server in the channel.
+// the prompts are available if the server is offered in the channel, and any of its tools is granted to the user.
+func (t toolSet) allowsPrompts(server string) bool {
+	return t.profile.OffersServer(server) && t.allowsServer(server)
 }
 
 // NewUseCase returns a new instance of UseCase.
+//
+//   - botID: The bot ID of the Slack app, whose messages in the threads are the turns of the assistant.
+//   - llmProvider: The LLM provider of the top-level settings, used by the channels without profiles.
+//   - llmProviders: The LLM providers of the channel profiles keyed by their settings.
 func NewUseCase(
 	timeoutNs time.Duration,
 	slackClient SlackClient,
+	botID string,
 	llmProvider llm.Provider,
-	tools []llm.Tool,
+	llmProviders map[config.LLMConfig]llm.Provider,
+	tools ToolRegistry,
+	toolNames ToolNames,
 	mcpClients map[string]client.MCPClient,
+	userClients UserClients,
+	access AccessControl,
 ) *UseCase {
 	return &UseCase{
 		timeoutNs:   timeoutNs,
 		slackClient: slackClient,
-		llmProvider: llmProvider,
+		botID:       botID,
 		tools:       tools,
-		mcpClients:  mcpClients,
+		toolNames:   toolNames,
+		userClients: userClients,
+		access:      access,
+		toolCalls:   make(map[client.MCPClient][]*toolCall),
+		deps: &dependencies{
+			llmProvider:  llmProvider,
+			llmProviders: llmProviders,
+			mcpClients:   mcpClients,
+			inUse:        &sync.WaitGroup{},
+		},
 	}
 }
 
+// Swap replaces the LLM providers and MCP clients used by subsequent sessions.
+// Sessions already in progress keep using the previous ones.
+//
+// The returned function blocks until all sessions using the previous dependencies finish.
+func (u *UseCase) Swap(llmProvider llm.Provider, llmProviders map[config.LLMConfig]llm.Provider, mcpClients map[string]client.MCPClient) (wait func()) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	prev := u.deps
+	u.deps = &dependencies{
+		llmProvider:  llmProvider,
+		llmProviders: llmProviders,
+		mcpClients:   mcpClients,
+		inUse:        &sync.WaitGroup{},
+	}
+	return prev.inUse.Wait
+}
+
+// acquire returns the current dependencies. The caller must call release when the session finishes.
+func (u *UseCase) acquire() (deps *dependencies, release func()) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	deps = u.deps
+	deps.inUse.Add(1)
+	return deps, deps.inUse.Done
+}
+
 // Execute handles LLM interactions and Slack message updates.
+// the earlier messages of the thread are sent to the LLM as the conversation history, unless disabled by the profile.
 //
 //   - sessionCtx: context representing the session for the operation.
+//   - profile: The profile of the channel, which selects the LLM provider and the tools of the session.
 //   - user: The Slack user ID who mentions the bot.
 //   - channel: The Slack channel ID where the message will be posted.
 //   - threadTs: The timestamp of the thread to reply to.
 //   - prompt: The prompt to send to the LLM.
-func (u *UseCase) Execute(sessionCtx context.Context, user, channel, threadTs, prompt string) error {
-	slog.Info("BEGIN UseCase.Execute", slog.String("channel", channel), slog.String("threadTs", threadTs), slog.String("prompt", prompt))
+func (u *UseCase) Execute(sessionCtx context.Context, profile config.Profile, user, channel, threadTs, prompt string) error {
+	slog.Info("BEGIN UseCase.Execute", slog.String("channel", channel), slog.String("threadTs", threadTs), slog.String("profile", profile.Channel), slog.String("prompt", prompt))
 	defer slog.Info("END UseCase.Execute", slog.String("channel", channel))
 
 	if prompt == "" {
 		return ErrEmptyPrompt
 	}
-	messages := []history.HistoryMessage{
-		{
-			Role: "user",
-			Content: []history.ContentBlock{{
-				Type: "text",
-				Text: prompt,
-			}},
-		},
+	sessionCtx, stopID, done, err := u.stoppable(sessionCtx, user, channel, threadTs)
+	if err != nil {
+		return err
+	}
+	defer done()
+	deps, release := u.acquire()
+	defer release()
+	tools := u.toolSet(sessionCtx, deps, profile, user, channel, threadTs)
+	var messages []history.HistoryMessage
+	if !profile.History.Disable {
+		messages = u.threadHistory(sessionCtx, channel, threadTs, profile.History.TokenLimit())
+	}
+	messages = appendTurn(messages, "user", prompt)
+	return u.execute(sessionCtx, deps.llmProviderOf(profile), tools, user, channel, threadTs, stopID, prompt, messages)
+}
+
+// toolSet returns the tools and MCP clients available to the user, including the ones connected with the user's own account.
+// the user is reminded to link the accounts not linked yet.
+//
+//   - profile: The profile of the channel, which offers a subset of the tools.
+func (u *UseCase) toolSet(ctx context.Context, deps *dependencies, profile config.Profile, user, channel, threadTs string) toolSet {
+	allows := func(server, tool string) bool {
+		return u.access.Allows(ctx, user, server, tool)
+	}
+	allowsServer := func(server string) bool {
+		return u.access.AllowsServer(ctx, user, server)
+	}
+	clients, tools, unlinked := u.userClients.Clients(ctx, user)
+	if len(clients) == 0 && len(unlinked) == 0 {
+		return toolSet{registry: u.tools, mcpClients: deps.mcpClients, names: u.toolNames, allows: allows, allowsServer: allowsServer, profile: profile}
+	}
+	for _, server := range unlinked {
+		u.remindLink(ctx, server, user, channel, threadTs)
+	}
+	for name, c := range deps.mcpClients {
+		clients[name] = c
+	}
+	return toolSet{
+		registry:     u.tools,
+		userTools:    tools,
+		mcpClients:   clients,
+		names:        u.toolNames,
+		allows:       allows,
+		allowsServer: allowsServer,
+		profile:      profile,
 	}
-	return u.execute(sessionCtx, user, channel, threadTs, prompt, messages)
+}
+
+// remindLink posts the link to link the account of the server, visible only to the user.
+// the user is reminded at most once per linkReminderInterval for each server.
+func (u *UseCase) remindLink(ctx context.Context, server, user, channel, threadTs string) {
+	key := fmt.Sprintf("%s#%s", server, user)
+	if last, ok := u.linkReminders.Load(key); ok && time.Since(last.(time.Time)) < linkReminderInterval {
+		return
+	}
+	linkURL, expiresAt, err := u.userClients.LinkURL(ctx, server, user)
+	if err != nil {
+		slog.Error("failed to create link", slog.String("server", server), slog.String("error", err.Error()))
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, u.timeoutNs)
+	defer cancel()
+	_, err = u.slackClient.PostEphemeralContext(
+		ctx,
+		channel,
+		user,
+		slack.MsgOptionText(
+			fmt.Sprintf(
+				"🔗 <%s|Link your account> to use `%s`. The link expires at <!date^%d^{time}|%s>.",
+				linkURL, server, expiresAt.Unix(), expiresAt.UTC().Format(time.Kitchen)),
+			false),
+		slack.MsgOptionTS(threadTs))
+	if err != nil {
+		slog.Error("failed to post link", slog.String("server", server), slog.String("error", err.Error()))
+		return
+	}
+	u.linkReminders.Store(key, time.Now())
 }
 
 var durationForLLMRateLimitExceeded = time.Minute + 30*time.Second
 
 // execute handles the LLM interactions and Slack message updates.
 // this method is called recursively to handle tool results.
-func (u *UseCase) execute(sessionCtx context.Context, user, channel, threadTs, prompt string, messages []history.HistoryMessage) error {
+// when the user stops the session, the note is posted in the thread instead of the answer.
+//
+//   - stopID: The ID of the Stop button shown while the session is in progress.
+func (u *UseCase) execute(sessionCtx context.Context, llmProvider llm.Provider, tools toolSet, user, channel, threadTs, stopID, prompt string, messages []history.HistoryMessage) error {
 	slog.Info("BEGIN UseCase.execute", slog.String("channel", channel), slog.String("threadTs", threadTs), slog.String("prompt", prompt))
 	defer slog.Info("END UseCase.execute", slog.String("channel", channel))
-	messageID, err := u.postMessage(sessionCtx, user, channel, "⌛ Thinking...", threadTs)
+	messageID, err := u.postMessage(sessionCtx, user, channel, "⌛ Thinking...", threadTs, stopBlocks(user, "⌛ Thinking...", stopID)...)
 	if err != nil {
 		return err
 	}
@@ -99,19 +333,22 @@ func (u *UseCase) execute(sessionCtx context.Context, user, channel, threadTs, p
 		llmMessages = append(llmMessages, &(messages)[i])
 	}
 
+	// the tools are read on each call, so that the tools changed by the servers during the session are available
+	llmTools := tools.llmTools()
 	var message llm.Message
 	err = retry.Do(
 		func() error {
 			ctx, cancel := context.WithTimeout(sessionCtx, u.timeoutNs)
 			defer cancel()
-			message, err = u.llmProvider.CreateMessage(
+			message, err = llmProvider.CreateMessage(
 				ctx,
 				prompt,
 				llmMessages,
-				u.tools,
+				llmTools,
 			)
 			return err
 		},
+		retry.Context(sessionCtx),
 		retry.Attempts(5),
 		retry.DelayType(retry.BackOffDelay),
 		retry.RetryIf(func(err error) bool {
@@ -120,7 +357,8 @@ func (u *UseCase) execute(sessionCtx context.Context, user, channel, threadTs, p
 		retry.DelayType(func(n uint, err error, config *retry.Config) time.Duration {
 			duration := retry.BackOffDelay(n, err, config)
 			if err != nil && strings.Contains(err.Error(), "rate_limit_error") {
-				messageID, _ = u.updateMessage(sessionCtx, user, channel, messageID, fmt.Sprintf("⌛ Rate limit exceeded. waiting for %d nanoseconds...", duration))
+				text := fmt.Sprintf("⌛ Rate limit exceeded. waiting for %d nanoseconds...", duration)
+				messageID, _ = u.updateMessage(sessionCtx, user, channel, messageID, text, stopBlocks(user, text, stopID)...)
 				if duration < durationForLLMRateLimitExceeded {
 					return durationForLLMRateLimitExceeded
 				}
@@ -129,8 +367,12 @@ func (u *UseCase) execute(sessionCtx context.Context, user, channel, threadTs, p
 		}),
 	)
 	if err != nil {
+		if stopped(sessionCtx) {
+			u.updateMessage(context.WithoutCancel(sessionCtx), user, channel, messageID, stoppedText)
+			return nil
+		}
 		slog.Error("failed to create message", slog.String("error", err.Error()))
-		u.updateMessage(sessionCtx, user, channel, messageID, "😵‍💫‍")
+		u.updateMessage(sessionCtx, user, channel, messageID, failedText)
 		return err
 	}
 
@@ -140,6 +382,7 @@ func (u *UseCase) execute(sessionCtx context.Context, user, channel, threadTs, p
 	)
 
 	// Add text content
+	var statusID string
 	if message.GetContent() != "" {
 		messageID, err = u.updateMessage(sessionCtx, user, channel, messageID, message.GetContent())
 		messageContents = append(messageContents, history.ContentBlock{
@@ -147,13 +390,17 @@ func (u *UseCase) execute(sessionCtx context.Context, user, channel, threadTs, p
 			Text: message.GetContent(),
 		})
 	} else {
-		// If the content is empty, delete the temporary message
-		u.slackClient.DeleteMessageContext(sessionCtx, channel, messageID)
+		// If the content is empty, the temporary message shows the status of the tool calls, and is deleted after them
+		statusID = messageID
 	}
 
 	// Handle tool calls
+	status := u.newStatusMessage(sessionCtx, user, channel, threadTs, statusID, stopID)
 	for _, toolCall := range message.GetToolCalls() {
-		messageContent, toolResult := u.handleToolCall(sessionCtx, toolCall, message)
+		if sessionCtx.Err() != nil {
+			break
+		}
+		messageContent, toolResult := u.handleToolCall(sessionCtx, tools, status, user, channel, threadTs, toolCall, message)
 		if len(messageContent) > 0 {
 			messageContents = slices.Concat(messageContents, messageContent)
 		}
@@ -161,6 +408,11 @@ func (u *UseCase) execute(sessionCtx context.Context, user, channel, threadTs, p
 			toolResults = slices.Concat(toolResults, toolResult)
 		}
 	}
+	status.close()
+	if stopped(sessionCtx) {
+		u.postMessage(context.WithoutCancel(sessionCtx), user, channel, stoppedText, threadTs)
+		return nil
+	}
 
 	messages = append(messages, history.HistoryMessage{
 		Role:    message.GetRole(),
@@ -174,13 +426,15 @@ func (u *UseCase) execute(sessionCtx context.Context, user, channel, threadTs, p
 			})
 		}
 		// Make another call to get Claude's response to the tool results
-		return u.execute(sessionCtx, user, channel, threadTs, "", messages)
+		return u.execute(sessionCtx, llmProvider, tools, user, channel, threadTs, stopID, "", messages)
 	}
 	return nil
 }
 
 // postMessage posts a message to the Slack channel and returns the message ID.
-func (u *UseCase) postMessage(ctx context.Context, user, channel, message, threadTs string) (string, error) {
+//
+//   - blocks: The blocks of the message, such as the Stop button. the message is shown as text if none.
+func (u *UseCase) postMessage(ctx context.Context, user, channel, message, threadTs string, blocks ...slack.Block) (string, error) {
 	slog.Info("BEGIN UseCase.postMessage", slog.String("channel", channel), slog.String("message", message), slog.String("threadTs", threadTs))
 	defer slog.Info("END UseCase.postMessage", slog.String("channel", channel))
 	ctx, cancel := context.WithTimeout(ctx, u.timeoutNs)
@@ -189,12 +443,15 @@ func (u *UseCase) postMessage(ctx context.Context, user, channel, message, threa
 		ctx,
 		channel,
 		slack.MsgOptionText(fmt.Sprintf("<@%s> \n%s", user, message), false),
+		slack.MsgOptionBlocks(blocks...),
 		slack.MsgOptionTS(threadTs))
 	return v, err
 }
 
 // updateMessage updates a message in the Slack channel and returns the message ID.
-func (u *UseCase) updateMessage(ctx context.Context, user, channel, messageID, message string) (string, error) {
+//
+//   - blocks: The blocks of the message. the previous blocks, such as the Stop button, are removed if none.
+func (u *UseCase) updateMessage(ctx context.Context, user, channel, messageID, message string, blocks ...slack.Block) (string, error) {
 	slog.Info("BEGIN UseCase.updateMessage", slog.String("channel", channel), slog.String("messageID", messageID), slog.String("message", message))
 	defer slog.Info("END UseCase.updateMessage", slog.String("channel", channel))
 	ctx, cancel := context.WithTimeout(ctx, u.timeoutNs)
@@ -203,12 +460,16 @@ func (u *UseCase) updateMessage(ctx context.Context, user, channel, messageID, m
 		ctx,
 		channel,
 		messageID,
-		slack.MsgOptionText(fmt.Sprintf("<@%s> \n%s", user, message), false))
+		slack.MsgOptionText(fmt.Sprintf("<@%s> \n%s", user, message), false),
+		// the empty blocks remove the previous ones, which are kept if omitted
+		slack.MsgOptionBlocks(append([]slack.Block{}, blocks...)...))
 	return v, err
 }
 
 // handleToolCall handles the tool call and returns the message content and tool results.
-func (u *UseCase) handleToolCall(sessionCtx context.Context, toolCall llm.ToolCall, message llm.Message) (messageContent []history.ContentBlock, toolResults []history.ContentBlock) {
+// the requests from the server during the call, such as sampling, are answered in the thread,
+// and the progress of the call is shown in the status message.
+func (u *UseCase) handleToolCall(sessionCtx context.Context, tools toolSet, status *statusMessage, user, channel, threadTs string, toolCall llm.ToolCall, message llm.Message) (messageContent []history.ContentBlock, toolResults []history.ContentBlock) {
 	slog.Info("Using tool", slog.String("tool_name", toolCall.GetName()))
 
 	input, err := json.Marshal(toolCall.GetArguments())
@@ -232,34 +493,67 @@ func (u *UseCase) handleToolCall(sessionCtx context.Context, toolCall llm.ToolCa
 			slog.Int("total_tokens", inputTokens+outputTokens))
 	}
 
-	parts := strings.Split(toolCall.GetName(), "__")
-	if len(parts) != 2 {
-		slog.Warn("invalid tool name format", slog.String("tool_name", toolCall.GetName()))
+	serverName, toolName, ok := u.toolNames.Resolve(toolCall.GetName())
+	if !ok {
+		slog.Warn("unknown tool name", slog.String("tool_name", toolCall.GetName()))
+		toolResults = append(toolResults, toolError(toolCall, "unknown tool"))
 		return
 	}
 
-	serverName, toolName := parts[0], parts[1]
-	mcpClient, ok := u.mcpClients[serverName]
+	mcpClient, ok := tools.mcpClients[serverName]
 	if !ok {
+		// the server may be removed by reload during the session
 		slog.Warn("server not found", slog.String("server_name", serverName))
+		toolResults = append(toolResults, toolError(toolCall, "the server is not available"))
+		return
+	}
+	// the LLM may call the tools not offered, such as the ones excluded after they appear in the thread
+	if !tools.profile.Offers(serverName, toolName) {
+		slog.Warn("tool not offered in channel", slog.String("channel", channel), slog.String("server_name", serverName), slog.String("tool_name", toolName))
+		toolResults = append(toolResults, toolError(toolCall, "the tool is not available in the channel"))
+		return
+	}
+	if !tools.allows(serverName, toolName) {
+		slog.Warn("tool not granted to user", slog.String("user", user), slog.String("server_name", serverName), slog.String("tool_name", toolName))
+		toolResults = append(toolResults, toolError(toolCall, "the user is not allowed to use the tool"))
+		return
+	}
+	policy, _ := mcpClient.(ToolPolicy)
+	if policy != nil && !policy.Allows(toolName) {
+		slog.Warn("tool not allowed", slog.String("server_name", serverName), slog.String("tool_name", toolName))
+		toolResults = append(toolResults, toolError(toolCall, "the tool is not allowed"))
 		return
 	}
 
 	var toolArgs map[string]any
 	if err := json.Unmarshal(input, &toolArgs); err != nil {
 		slog.Warn("failed to unmarshal tool arguments", slog.String("error", err.Error()))
+		toolResults = append(toolResults, toolError(toolCall, "the arguments are not a JSON object"))
 		return
 	}
 
-	req := mcp.CallToolRequest{}
-	req.Params.Name = toolName
-	req.Params.Arguments = toolArgs
+	if policy != nil && policy.RequiresApproval(toolName) {
+		approved, err := u.askApproval(sessionCtx, user, channel, threadTs, toolApprovalText(toolCall.GetName(), toolArgs))
+		if err != nil || !approved {
+			reason := "the call was denied by the user"
+			if err != nil {
+				slog.Warn("failed to ask approval of tool call", slog.String("error", err.Error()))
+				reason = err.Error()
+			}
+			toolResults = append(toolResults, toolError(toolCall, reason))
+			return
+		}
+	}
 
 	toolResult, err := func() (*mcp.CallToolResult, error) {
-		ctx, cancel := context.WithTimeout(sessionCtx, u.timeoutNs)
-		defer cancel()
+		call, end := u.beginToolCall(sessionCtx, mcpClient, toolCall.GetName(), status, tools.profile, user, channel, threadTs)
+		defer end()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = toolName
+		req.Params.Arguments = toolArgs
+		req.Params.Meta = &mcp.Meta{ProgressToken: call.token}
 		return mcpClient.CallTool(
-			ctx,
+			call.ctx,
 			req,
 		)
 	}()
@@ -282,26 +576,78 @@ func (u *UseCase) handleToolCall(sessionCtx context.Context, toolCall llm.ToolCa
 		return
 	}
 
-	if len(toolResult.Content) != 0 {
-		// Create the tool result block
-		resultBlock := history.ContentBlock{
+	toolResults = append(toolResults, toolResultBlock(toolCall, toolResult))
+	return
+}
+
+// noToolContent is the text of the result of the tool call returning no content.
+const noToolContent = "(no content)"
+
+// toolResultBlock returns the result of the tool call.
+// the result has the text of noToolContent if the tool returns no content, since every tool_use must be followed by its tool_result.
+func toolResultBlock(toolCall llm.ToolCall, toolResult *mcp.CallToolResult) history.ContentBlock {
+	if toolResult == nil || len(toolResult.Content) == 0 {
+		return history.ContentBlock{
 			Type:      "tool_result",
 			ToolUseID: toolCall.GetID(),
-			Content:   toolResult.Content,
+			Content:   []history.ContentBlock{{Type: "text", Text: noToolContent}},
+			Text:      noToolContent,
 		}
+	}
+	// Create the tool result block
+	resultBlock := history.ContentBlock{
+		Type:      "tool_result",
+		ToolUseID: toolCall.GetID(),
+		Content:   toolResult.Content,
+	}
 
-		// Extract text content
-		var resultText string
-		// Handle array content directly since we know it's []interface{}
-		for _, item := range toolResult.Content {
-			if contentMap, ok := any(item).(map[string]any); ok {
-				if text, ok := contentMap["text"]; ok {
-					resultText = fmt.Sprintf("%s%v ", resultText, text)
-				}
+	// Extract text content
+	var resultText string
+	// Handle array content directly since we know it's []interface{}
+	for _, item := range toolResult.Content {
+		if contentMap, ok := any(item).(map[string]any); ok {
+			if text, ok := contentMap["text"]; ok {
+				resultText = fmt.Sprintf("%s%v ", resultText, text)
 			}
 		}
-		resultBlock.Text = strings.TrimSpace(resultText)
-		toolResults = append(toolResults, resultBlock)
 	}
-	return
+	resultBlock.Text = strings.TrimSpace(resultText)
+	return resultBlock
+}
+
+// toolError returns the result of the tool call that is not made, telling the LLM the reason.
+func toolError(toolCall llm.ToolCall, reason string) history.ContentBlock {
+	return history.ContentBlock{
+		Type:      "tool_result",
+		ToolUseID: toolCall.GetID(),
+		Content: []history.ContentBlock{{
+			Type: "text",
+			Text: fmt.Sprintf("Error calling tool %s: %s", toolCall.GetName(), reason),
+		}},
+	}
+}
+
+// toolArgumentsPreviewLength is the maximum length of the arguments of the tool call shown to the user on approval.
+const toolArgumentsPreviewLength = 2000
+
+// toolApprovalText returns the text asking the user to approve the tool call with the pretty-printed arguments.
+//
+//   - name: The name of the tool sent to the LLM.
+func toolApprovalText(name string, args map[string]any) string {
+	text := fmt.Sprintf("⚠️ The model requests to call `%s`.", name)
+	if len(args) == 0 {
+		return text
+	}
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(args); err != nil {
+		return text
+	}
+	preview := strings.TrimSpace(b.String())
+	if r := []rune(preview); len(r) > toolArgumentsPreviewLength {
+		preview = string(r[:toolArgumentsPreviewLength]) + "…"
+	}
+	return fmt.Sprintf("%s\n```\n%s\n```", text, slackutilsx.EscapeMessage(preview))
 }
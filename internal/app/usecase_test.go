@@ -0,0 +1,59 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcphost/pkg/history"
+)
+
+// fakeToolCall is llm.ToolCall of the name and ID.
+type fakeToolCall struct {
+	id   string
+	name string
+}
+
+func (c fakeToolCall) GetName() string              { return c.name }
+func (c fakeToolCall) GetArguments() map[string]any { return nil }
+func (c fakeToolCall) GetID() string                { return c.id }
+
+func TestToolResultBlock(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *mcp.CallToolResult
+		// wantContent is the number of the content blocks of the result.
+		wantContent int
+		wantText    string
+	}{
+		{
+			name:        "content",
+			result:      &mcp.CallToolResult{Content: []mcp.Content{mcp.NewTextContent("a"), mcp.NewTextContent("b")}},
+			wantContent: 2,
+		},
+		{name: "empty content", result: &mcp.CallToolResult{}, wantContent: 1, wantText: noToolContent},
+		{name: "no result", result: nil, wantContent: 1, wantText: noToolContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toolResultBlock(fakeToolCall{id: "toolu_1", name: "github__get_issue"}, tt.result)
+			if got.Type != "tool_result" || got.ToolUseID != "toolu_1" {
+				t.Errorf("toolResultBlock() type, tool use ID = %q, %q, want tool_result, toolu_1", got.Type, got.ToolUseID)
+			}
+			var n int
+			switch content := got.Content.(type) {
+			case []mcp.Content:
+				n = len(content)
+			case []history.ContentBlock:
+				n = len(content)
+				if content[0].Text != tt.wantText {
+					t.Errorf("toolResultBlock() content text = %q, want %q", content[0].Text, tt.wantText)
+				}
+			default:
+				t.Fatalf("toolResultBlock() content = %T, want content blocks", got.Content)
+			}
+			if n != tt.wantContent {
+				t.Errorf("toolResultBlock() has %d content blocks, want %d", n, tt.wantContent)
+			}
+		})
+	}
+}
@@ -0,0 +1,587 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// EnvPrefix is the prefix of environment variables that override the configuration.
+const EnvPrefix = "SLACKBOT_MCP_HOST_"
+
+// Config represents the configuration of slackbot-mcp-host.
+type Config struct {
+	MCPServers       map[string]MCPServerConfig `json:"mcpServers"`
+	TimeoutNs        int64                      `json:"timeoutNs"`
+	LLMProviderName  string                     `json:"llmProviderName"`
+	LLMApiKey        string                     `json:"llmApiKey"`
+	LLMBaseURL       string                     `json:"llmBaseUrl"`
+	LLMModelName     string                     `json:"llmModelName"`
+	SlackBotToken    string                     `json:"slackBotToken"`
+	SackSinginSecret string                     `json:"slackSigninSecret"`
+	AllowedUsers     []string                   `json:"allowedUsers"`
+	Port             int                        `json:"port"`
+	GCPProjectId     string                     `json:"gcpProjectId"`
+	RateLimit        RateLimitConfig            `json:"rateLimit"`
+	// PublicURL is the URL of the bot reachable from the browsers of the users, used to link their accounts.
+	PublicURL string `json:"publicUrl"`
+	// Access grants the tools of the MCP servers to the Slack users by their roles. all users can use all tools if nil.
+	Access *AccessConfig `json:"access"`
+	// Channels restricts the Slack channels the bot responds in, and customizes the sessions in them.
+	// the bot responds in all channels with the top-level settings if nil.
+	Channels *ChannelsConfig `json:"channels"`
+	// History is the configuration of the earlier messages of the thread sent to the LLM.
+	History HistoryConfig `json:"history"`
+}
+
+// LLM returns the top-level settings of the LLM.
+func (c *Config) LLM() LLMConfig {
+	return LLMConfig{
+		ProviderName: c.LLMProviderName,
+		APIKey:       c.LLMApiKey,
+		BaseURL:      c.LLMBaseURL,
+		ModelName:    c.LLMModelName,
+	}
+}
+
+// LLMConfigs returns the settings of the LLM of the top-level and the channel profiles without duplicates, the top-level first.
+func (c *Config) LLMConfigs() []LLMConfig {
+	configs := []LLMConfig{c.LLM()}
+	if c.Channels == nil {
+		return configs
+	}
+	for _, channel := range sortedKeys(c.Channels.Profiles) {
+		profile, ok := c.Profile(channel)
+		if ok && !slices.Contains(configs, profile.LLM) {
+			configs = append(configs, profile.LLM)
+		}
+	}
+	return configs
+}
+
+// Profile returns the settings of the sessions in the Slack channel, merged with the top-level settings.
+// returns false if the bot does not respond in the channel.
+func (c *Config) Profile(channel string) (Profile, bool) {
+	profile := Profile{LLM: c.LLM(), RateLimit: c.RateLimit, History: c.History}
+	if c.Channels == nil {
+		return profile, true
+	}
+	if !c.Channels.Allows(channel) {
+		return Profile{}, false
+	}
+	p, ok := c.Channels.Profiles[channel]
+	if !ok {
+		return profile, true
+	}
+	profile.Channel = channel
+	if p.LLMProviderName != "" && p.LLMProviderName != c.LLMProviderName {
+		// the settings of the other provider are not inherited
+		profile.LLM = LLMConfig{ProviderName: p.LLMProviderName}
+	}
+	profile.LLM.APIKey = cmp.Or(p.LLMApiKey, profile.LLM.APIKey)
+	profile.LLM.BaseURL = cmp.Or(p.LLMBaseURL, profile.LLM.BaseURL)
+	profile.LLM.ModelName = cmp.Or(p.LLMModelName, profile.LLM.ModelName)
+	profile.LLM.SystemPrompt = p.SystemPrompt
+	profile.Servers = p.Servers
+	profile.Tools = p.Tools
+	if p.RateLimit != nil {
+		profile.RateLimit = *p.RateLimit
+	}
+	if p.History != nil {
+		profile.History = *p.History
+	}
+	return profile, true
+}
+
+const (
+	TransportStdio          = "stdio"
+	TransportSSE            = "sse"
+	TransportStreamableHTTP = "streamable_http"
+)
+
+// MCPServerConfig represents the configuration of an MCP server.
+type MCPServerConfig struct {
+	// Type is the transport type of the server. defaults to sse if URL is set, otherwise stdio.
+	Type    string         `json:"type"`
+	Command string         `json:"command"`
+	Args    []string       `json:"args"`
+	Env     map[string]any `json:"env"`
+	// Cwd is the working directory of the stdio server. defaults to the working directory of the host process.
+	Cwd string `json:"cwd"`
+	// InheritEnv specifies whether the stdio server inherits the environment variables of the host process. defaults to true.
+	InheritEnv *bool `json:"inheritEnv"`
+	// URL is the endpoint of the remote server.
+	URL string `json:"url"`
+	// Headers are the HTTP headers sent to the remote server.
+	Headers map[string]string `json:"headers"`
+	// BearerToken is sent to the remote server as `Authorization: Bearer <BearerToken>`.
+	BearerToken string    `json:"bearerToken"`
+	TLS         TLSConfig `json:"tls"`
+	// Listen specifies whether to keep a GET stream open to receive messages from the streamable HTTP server.
+	// the stream is resumed from the last received event on reconnection.
+	Listen bool `json:"listen"`
+	// OAuth authorizes the requests to the remote server with OAuth 2.1 access token.
+	OAuth *OAuthConfig `json:"oauth"`
+	// PerUser specifies whether to connect to the server for each Slack user with the user's own account,
+	// linked with authorization_code grant.
+	PerUser bool `json:"perUser"`
+	// Required specifies whether the bot fails to start when the server fails to start.
+	// optional servers that fail to start are skipped and retried in background.
+	Required bool `json:"required"`
+	// Sampling allows the server to sample messages from the LLM of the host. disabled if nil.
+	Sampling *SamplingConfig `json:"sampling"`
+	// Roots are the roots advertised to the server, which vary by the Slack channel of the tool call. not advertised if nil.
+	Roots *RootsConfig `json:"roots"`
+	// Tools filters and renames the tools of the server offered to the LLM. all tools are offered as they are if nil.
+	Tools *ToolsConfig `json:"tools"`
+}
+
+// Transport returns the transport type of the server.
+func (c MCPServerConfig) Transport() string {
+	switch {
+	case c.Type != "":
+		return c.Type
+	case c.URL != "":
+		return TransportSSE
+	default:
+		return TransportStdio
+	}
+}
+
+// InheritsEnv reports whether the stdio server inherits the environment variables of the host process.
+func (c MCPServerConfig) InheritsEnv() bool {
+	return c.InheritEnv == nil || *c.InheritEnv
+}
+
+// DefaultSamplingMaxTokens is the default maximum number of tokens a sampling request may ask for.
+const DefaultSamplingMaxTokens = 4096
+
+// SamplingConfig is the configuration of the sampling requests from the MCP server.
+type SamplingConfig struct {
+	// MaxTokens is the maximum number of tokens a sampling request may ask for. defaults to DefaultSamplingMaxTokens.
+	MaxTokens int `json:"maxTokens"`
+	// Approval specifies whether each sampling request must be approved on Slack by the user who called the tool.
+	Approval bool `json:"approval"`
+}
+
+// TokenLimit returns the maximum number of tokens a sampling request may ask for.
+func (c SamplingConfig) TokenLimit() int {
+	if c.MaxTokens == 0 {
+		return DefaultSamplingMaxTokens
+	}
+	return c.MaxTokens
+}
+
+// RootsConfig is the configuration of the roots advertised to the MCP server.
+type RootsConfig struct {
+	// Default are the roots of the channels not in Channels, and of the requests not made from a channel.
+	Default []RootConfig `json:"default"`
+	// Channels are the roots of the Slack channels keyed by the channel ID.
+	Channels map[string][]RootConfig `json:"channels"`
+}
+
+// Of returns the roots of the Slack channel.
+func (c RootsConfig) Of(channel string) []RootConfig {
+	if roots, ok := c.Channels[channel]; ok {
+		return roots
+	}
+	return c.Default
+}
+
+// RootConfig is a root, the directory or the URI scope the server may operate on.
+type RootConfig struct {
+	// URI identifies the root, such as `file:///srv/team-a`.
+	URI  string `json:"uri"`
+	Name string `json:"name"`
+}
+
+// ToolsConfig is the configuration of the tools of the MCP server offered to the LLM.
+type ToolsConfig struct {
+	// Include are the glob patterns of the tool names offered to the LLM, such as `get_*`. all tools if empty.
+	Include []string `json:"include"`
+	// Exclude are the glob patterns of the tool names not offered to the LLM, even if included.
+	Exclude []string `json:"exclude"`
+	// Overrides override the tools keyed by the tool names of the server.
+	Overrides map[string]ToolOverride `json:"overrides"`
+	// Approval are the glob patterns of the tool names whose calls must be approved on Slack by the user who asks.
+	Approval []string `json:"approval"`
+	// ApproveDestructive specifies whether the calls of the tools annotated as destructive by the server must be approved, as Approval.
+	ApproveDestructive bool `json:"approveDestructive"`
+}
+
+// Allows reports whether the tool is offered to the LLM. all tools are allowed if c is nil.
+// the patterns are matched with path.Match, and the invalid ones match nothing.
+func (c *ToolsConfig) Allows(tool string) bool {
+	if c == nil {
+		return true
+	}
+	return (len(c.Include) == 0 || matchAny(c.Include, tool)) && !matchAny(c.Exclude, tool)
+}
+
+// RequiresApproval reports whether the calls of the tool must be approved by the user. no tools require it if c is nil.
+//
+//   - destructive: Whether the tool is annotated as destructive by the server.
+func (c *ToolsConfig) RequiresApproval(tool string, destructive bool) bool {
+	if c == nil {
+		return false
+	}
+	return (c.ApproveDestructive && destructive) || matchAny(c.Approval, tool)
+}
+
+// matchAny reports whether the name matches any of the glob patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Override returns the override of the tool, or the zero value if not overridden.
+func (c *ToolsConfig) Override(tool string) ToolOverride {
+	if c == nil {
+		return ToolOverride{}
+	}
+	return c.Overrides[tool]
+}
+
+// ToolOverride overrides how the tool is offered to the LLM.
+type ToolOverride struct {
+	// Alias is the name of the tool shown to the LLM instead of the name on the server.
+	Alias string `json:"alias"`
+	// Description replaces the description of the tool given by the server.
+	Description string `json:"description"`
+}
+
+// TLSConfig represents the TLS configuration for connecting to a remote server.
+type TLSConfig struct {
+	// CAFile is the path of the PEM encoded CA certificates to verify the server. defaults to the system pool.
+	CAFile string `json:"caFile"`
+	// CertFile and KeyFile are the paths of the PEM encoded client certificate and key for mutual TLS.
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// ServerName overrides the server name used to verify the certificate.
+	ServerName         string `json:"serverName"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+const (
+	OAuthGrantClientCredentials = "client_credentials"
+	OAuthGrantRefreshToken      = "refresh_token"
+	OAuthGrantAuthorizationCode = "authorization_code"
+)
+
+// OAuthConfig is the configuration to obtain access tokens for the remote MCP server.
+type OAuthConfig struct {
+	// GrantType is the grant to obtain access tokens. defaults to refresh_token if RefreshToken is set, otherwise client_credentials.
+	GrantType    string `json:"grantType"`
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	// RefreshToken is the pre-provisioned refresh token for refresh_token grant.
+	RefreshToken string   `json:"refreshToken"`
+	Scopes       []string `json:"scopes"`
+	// AuthServerMetadataURL is the URL of the authorization server metadata.
+	// defaults to the one discovered from the protected resource metadata of the server.
+	AuthServerMetadataURL string `json:"authServerMetadataUrl"`
+	// TokenFile is the path of the file to persist tokens across restarts. tokens are kept in memory if empty.
+	TokenFile string `json:"tokenFile"`
+	// TokenDir is the directory to persist the tokens of each user of a per-user server. tokens are kept in memory if empty.
+	TokenDir string `json:"tokenDir"`
+}
+
+// Grant returns the grant type to obtain access tokens.
+func (c OAuthConfig) Grant() string {
+	switch {
+	case c.GrantType != "":
+		return c.GrantType
+	case c.RefreshToken != "":
+		return OAuthGrantRefreshToken
+	default:
+		return OAuthGrantClientCredentials
+	}
+}
+
+// AnyRole is the role of the policies granted to all users.
+const AnyRole = "*"
+
+// AccessConfig is the configuration of the role-based access control of the tools.
+type AccessConfig struct {
+	// Roles are the roles of the Slack users keyed by the role name.
+	Roles map[string]RoleConfig `json:"roles"`
+	// Policies grant the tools to the roles. the user can use a tool if any policy of the user's roles grants it.
+	Policies []PolicyConfig `json:"policies"`
+}
+
+// RoleConfig is the configuration of the users having the role.
+type RoleConfig struct {
+	// Users are the Slack user IDs having the role.
+	Users []string `json:"users"`
+	// Groups are the Slack user group IDs whose members have the role.
+	Groups []string `json:"groups"`
+}
+
+// PolicyConfig is the configuration of the tools granted to the roles.
+type PolicyConfig struct {
+	// Roles are the names of the roles granted the tools. AnyRole grants them to all users.
+	Roles []string `json:"roles"`
+	// Servers are the glob patterns of the MCP server names.
+	Servers []string `json:"servers"`
+	// Tools are the glob patterns of the tool names of the servers, not the aliases. all tools if empty.
+	Tools []string `json:"tools"`
+}
+
+// Grants reports whether the policy grants the tool of the server.
+func (c PolicyConfig) Grants(server, tool string) bool {
+	return c.GrantsServer(server) && (len(c.Tools) == 0 || matchAny(c.Tools, tool))
+}
+
+// GrantsServer reports whether the policy grants any tool of the server.
+func (c PolicyConfig) GrantsServer(server string) bool {
+	return matchAny(c.Servers, server)
+}
+
+// ChannelsConfig is the configuration of the Slack channels the bot responds in.
+type ChannelsConfig struct {
+	// Allowed are the Slack channel IDs the bot responds in. all channels if empty.
+	Allowed []string `json:"allowed"`
+	// Denied are the Slack channel IDs the bot does not respond in, even if allowed.
+	Denied []string `json:"denied"`
+	// Profiles are the settings of the sessions in the channels keyed by the Slack channel ID.
+	Profiles map[string]ProfileConfig `json:"profiles"`
+}
+
+// Allows reports whether the bot responds in the Slack channel. all channels are allowed if c is nil.
+func (c *ChannelsConfig) Allows(channel string) bool {
+	if c == nil {
+		return true
+	}
+	return (len(c.Allowed) == 0 || slices.Contains(c.Allowed, channel)) && !slices.Contains(c.Denied, channel)
+}
+
+// ProfileConfig is the configuration of the sessions in a Slack channel. the top-level settings are used for the fields not set.
+type ProfileConfig struct {
+	// LLMProviderName overrides llmProviderName. the other LLM settings are not inherited if the provider differs from the top-level one.
+	LLMProviderName string `json:"llmProviderName"`
+	LLMApiKey       string `json:"llmApiKey"`
+	LLMBaseURL      string `json:"llmBaseUrl"`
+	LLMModelName    string `json:"llmModelName"`
+	// SystemPrompt is the system prompt of the LLM in the channel. none if empty.
+	SystemPrompt string `json:"systemPrompt"`
+	// Servers are the glob patterns of the MCP server names whose tools are offered in the channel. all servers if empty.
+	Servers []string `json:"servers"`
+	// Tools are the glob patterns of the tool names of the servers offered in the channel, not the aliases. all tools if empty.
+	Tools []string `json:"tools"`
+	// RateLimit overrides rateLimit in the channel.
+	RateLimit *RateLimitConfig `json:"rateLimit"`
+	// History overrides history in the channel.
+	History *HistoryConfig `json:"history"`
+}
+
+// LLMConfig is the settings of the LLM, which identify the LLM provider.
+type LLMConfig struct {
+	ProviderName string
+	APIKey       string
+	BaseURL      string
+	ModelName    string
+	SystemPrompt string
+}
+
+// Profile is the settings of the sessions in a Slack channel, merged with the top-level settings.
+type Profile struct {
+	// Channel is the Slack channel ID of the profile. empty if the channel has no profile.
+	Channel   string
+	LLM       LLMConfig
+	Servers   []string
+	Tools     []string
+	RateLimit RateLimitConfig
+	History   HistoryConfig
+}
+
+// Offers reports whether the tool of the MCP server is offered in the channel.
+//
+//   - tool: The name of the tool on the server, not the alias.
+func (p Profile) Offers(server, tool string) bool {
+	return p.OffersServer(server) && (len(p.Tools) == 0 || matchAny(p.Tools, tool))
+}
+
+// OffersServer reports whether the MCP server is offered in the channel, regardless of its tools.
+func (p Profile) OffersServer(server string) bool {
+	return len(p.Servers) == 0 || matchAny(p.Servers, server)
+}
+
+// DefaultHistoryMaxTokens is the default budget of the tokens of the earlier messages of the thread.
+const DefaultHistoryMaxTokens = 8000
+
+// HistoryConfig is the configuration of the earlier messages of the Slack thread, sent to the LLM as the conversation history.
+type HistoryConfig struct {
+	// Disable specifies whether to send only the mention to the LLM, without the earlier messages of the thread.
+	Disable bool `json:"disable"`
+	// MaxTokens is the budget of the estimated tokens of the earlier messages. the older messages over it are left out.
+	// defaults to DefaultHistoryMaxTokens.
+	MaxTokens int `json:"maxTokens"`
+}
+
+// TokenLimit returns the budget of the tokens of the earlier messages of the thread.
+func (c HistoryConfig) TokenLimit() int {
+	if c.MaxTokens == 0 {
+		return DefaultHistoryMaxTokens
+	}
+	return c.MaxTokens
+}
+
+// RateLimitConfig represents the configuration of the rate limiter.
+type RateLimitConfig struct {
+	Enable    bool    `json:"enable"`
+	Limit     float64 `json:"limit"`
+	Burst     int     `json:"burst"`
+	ExpressIn int64   `json:"expiresIn"`
+}
+
+// Load builds the configuration from the following sources.
+// Later sources take precedence over earlier ones.
+//
+//  1. defaults: The configuration embedded in the binary. may be empty.
+//  2. path: The configuration file. may be empty.
+//  3. secretsDir: The directory containing one file per top-level key, e.g. `<secretsDir>/slackBotToken`. may be empty.
+//  4. Environment variables named after the top-level keys, e.g. `SLACKBOT_MCP_HOST_SLACK_BOT_TOKEN`.
+//
+// String values of secret files and environment variables are used as is,
+// while values for other types are decoded as JSON.
+//
+// Finally, `${ENV_VAR}` and `file://` references in the secret values are resolved and the configuration is validated.
+// If the configuration is invalid, Load returns it along with *ValidationError.
+func Load(defaults []byte, path, secretsDir string) (*Config, error) {
+	var (
+		cfg     Config
+		unknown []string
+	)
+	if len(defaults) > 0 {
+		if err := json.Unmarshal(defaults, &cfg); err != nil {
+			return nil, errors.Wrap(err, "failed to parse embedded config")
+		}
+		keys, _ := unknownFields(defaults, reflect.TypeOf(cfg), "")
+		for _, k := range keys {
+			unknown = append(unknown, fmt.Sprintf("unknown field %s in embedded config", k))
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to read config file: %s", path))
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to parse config file: %s", path))
+		}
+		keys, _ := unknownFields(data, reflect.TypeOf(cfg), "")
+		for _, k := range keys {
+			unknown = append(unknown, fmt.Sprintf("unknown field %s in config file %s", k, path))
+		}
+	}
+	if secretsDir != "" {
+		keys, err := overlay(&cfg, func(key string) (string, bool, error) {
+			data, err := os.ReadFile(filepath.Join(secretsDir, key))
+			if err != nil {
+				if os.IsNotExist(err) {
+					return "", false, nil
+				}
+				return "", false, err
+			}
+			return strings.TrimRight(string(data), "\r\n"), true, nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to apply secrets directory: %s", secretsDir))
+		}
+		for _, k := range keys {
+			unknown = append(unknown, fmt.Sprintf("unknown field %s in secrets directory %s", k, secretsDir))
+		}
+	}
+	keys, err := overlay(&cfg, func(key string) (string, bool, error) {
+		v, ok := os.LookupEnv(EnvName(key))
+		return v, ok, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to apply environment variables")
+	}
+	for _, k := range keys {
+		unknown = append(unknown, fmt.Sprintf("unknown field %s in environment variables", k))
+	}
+	if err := interpolate(&cfg); err != nil {
+		return nil, err
+	}
+
+	problems := unknown
+	var validationErr *ValidationError
+	if errors.As(cfg.Validate(), &validationErr) {
+		problems = append(problems, validationErr.Problems...)
+	}
+	if len(problems) > 0 {
+		return &cfg, &ValidationError{Problems: problems}
+	}
+	return &cfg, nil
+}
+
+// overlay overwrites the top-level fields of cfg with the values returned by lookup
+// and returns the paths of unknown nested keys in them.
+func overlay(cfg *Config, lookup func(key string) (string, bool, error)) ([]string, error) {
+	var unknown []string
+	t := reflect.TypeOf(*cfg)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		value, ok, err := lookup(key)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to look up %s", key))
+		}
+		if !ok {
+			continue
+		}
+		raw := json.RawMessage(value)
+		if field.Type.Kind() == reflect.String {
+			if raw, err = json.Marshal(value); err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("failed to encode %s", key))
+			}
+		}
+		data, err := json.Marshal(map[string]json.RawMessage{key: raw})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("invalid value for %s", key))
+		}
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("invalid value for %s", key))
+		}
+		if field.Type.Kind() != reflect.String {
+			keys, _ := unknownFields(raw, field.Type, key)
+			unknown = append(unknown, keys...)
+		}
+	}
+	return unknown, nil
+}
+
+// EnvName returns the name of the environment variable that overrides the given top-level key.
+//
+//	EnvName("slackBotToken") // SLACKBOT_MCP_HOST_SLACK_BOT_TOKEN
+func EnvName(key string) string {
+	var b strings.Builder
+	b.WriteString(EnvPrefix)
+	runes := []rune(key)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(!unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			b.WriteRune('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeFile writes data to the file named name in dir, and returns its path.
+func writeFile(t *testing.T, dir, name, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "slackBotToken", want: "SLACKBOT_MCP_HOST_SLACK_BOT_TOKEN"},
+		{key: "llmApiKey", want: "SLACKBOT_MCP_HOST_LLM_API_KEY"},
+		{key: "llmBaseUrl", want: "SLACKBOT_MCP_HOST_LLM_BASE_URL"},
+		{key: "mcpServers", want: "SLACKBOT_MCP_HOST_MCP_SERVERS"},
+		{key: "gcpProjectId", want: "SLACKBOT_MCP_HOST_GCP_PROJECT_ID"},
+		{key: "timeoutNs", want: "SLACKBOT_MCP_HOST_TIMEOUT_NS"},
+		{key: "port", want: "SLACKBOT_MCP_HOST_PORT"},
+		{key: "publicURL", want: "SLACKBOT_MCP_HOST_PUBLIC_URL"},
+		{key: "HTTPServer", want: "SLACKBOT_MCP_HOST_HTTP_SERVER"},
+	}
+	for _, tt := range tests {
+		if got := EnvName(tt.key); got != tt.want {
+			t.Errorf("EnvName(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	defaults := `{"llmProviderName": "anthropic", "llmModelName": "default-model", "llmApiKey": "default-key", "slackBotToken": "default-token", "slackSigninSecret": "default-secret", "port": 1000}`
+	dir := t.TempDir()
+	path := writeFile(t, dir, "config.json", `{"llmModelName": "file-model", "llmApiKey": "file-key", "slackBotToken": "file-token", "port": 2000}`)
+	secretsDir := filepath.Join(dir, "secrets")
+	if err := os.Mkdir(secretsDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	// the trailing newline of the secret file is trimmed
+	writeFile(t, secretsDir, "llmApiKey", "secret-key\n")
+	writeFile(t, secretsDir, "slackBotToken", "secret-token")
+	writeFile(t, secretsDir, "port", "3000")
+	t.Setenv(EnvName("slackBotToken"), "env-token")
+	t.Setenv(EnvName("port"), "4000")
+	t.Setenv(EnvName("allowedUsers"), `["U1", "U2"]`)
+
+	cfg, err := Load([]byte(defaults), path, secretsDir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	tests := []struct {
+		key  string
+		got  any
+		want any
+	}{
+		{key: "slackSigninSecret", got: cfg.SackSinginSecret, want: "default-secret"},
+		{key: "llmModelName", got: cfg.LLMModelName, want: "file-model"},
+		{key: "llmApiKey", got: cfg.LLMApiKey, want: "secret-key"},
+		{key: "slackBotToken", got: cfg.SlackBotToken, want: "env-token"},
+		{key: "port", got: cfg.Port, want: 4000},
+		{key: "allowedUsers", got: strings.Join(cfg.AllowedUsers, ","), want: "U1,U2"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.key, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoad_Problems(t *testing.T) {
+	valid := `"slackBotToken": "token", "slackSigninSecret": "secret"`
+	tests := []struct {
+		name   string
+		config string
+		env    map[string]string
+		// want are the problems reported at once.
+		want []string
+	}{
+		{
+			name:   "valid",
+			config: `{"llmProviderName": "anthropic", ` + valid + `}`,
+		},
+		{
+			name:   "typo of provider",
+			config: `{"llmProviderName": "antropic", ` + valid + `}`,
+			want:   []string{`llmProviderName "antropic" is not supported. must be one of anthropic, openai, google`},
+		},
+		{
+			name:   "unknown fields",
+			config: `{"llmProviderName": "anthropic", "slackBotTokn": "token", "mcpServers": {"fetch": {"command": "fetch", "evn": {}}}, ` + valid + `}`,
+			want: []string{
+				"unknown field mcpServers.fetch.evn in config file",
+				"unknown field slackBotTokn in config file",
+			},
+		},
+		{
+			name:   "unknown field in environment variables",
+			config: `{"llmProviderName": "anthropic", ` + valid + `}`,
+			env:    map[string]string{EnvName("rateLimit"): `{"enable": true, "limit": 1, "burst": 1, "expire": 10}`},
+			want:   []string{"unknown field rateLimit.expire in environment variables"},
+		},
+		{
+			name:   "google without model",
+			config: `{"llmProviderName": "google", ` + valid + `}`,
+			want:   []string{"llmModelName is required for google"},
+		},
+		{
+			name:   "sampling without model",
+			config: `{"llmProviderName": "anthropic", "mcpServers": {"fetch": {"command": "fetch", "sampling": {}}}, ` + valid + `}`,
+			want:   []string{"llmModelName is required for mcpServers.fetch.sampling"},
+		},
+		{
+			name:   "burst 0",
+			config: `{"llmProviderName": "anthropic", "rateLimit": {"enable": true, "limit": 1, "burst": 0}, ` + valid + `}`,
+			want:   []string{"rateLimit.burst must be greater than 0: 0"},
+		},
+		{
+			name:   "bad durations",
+			config: `{"llmProviderName": "anthropic", "timeoutNs": -1, "rateLimit": {"enable": true, "limit": 1, "burst": 1, "expiresIn": -1}, ` + valid + `}`,
+			want: []string{
+				"timeoutNs must not be negative: -1",
+				"rateLimit.expiresIn must not be negative: -1",
+			},
+		},
+		{
+			name: "all problems at once",
+			config: `{"llmProviderName": "antropic", "port": 70000, "unknown": true, ` +
+				`"rateLimit": {"enable": true, "limit": 0, "burst": 0}, ` +
+				`"mcpServers": {"remote": {"type": "sse"}}}`,
+			want: []string{
+				"unknown field unknown in config file",
+				`llmProviderName "antropic" is not supported`,
+				"slackBotToken is required",
+				"slackSigninSecret is required",
+				"port must be between 0 and 65535: 70000",
+				"mcpServers.remote.url is required for sse transport",
+				"rateLimit.limit must be greater than 0: 0",
+				"rateLimit.burst must be greater than 0: 0",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := writeFile(t, t.TempDir(), "config.json", tt.config)
+			cfg, err := Load(nil, path, "")
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Load() error = %v", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Load() error = %v, want *ValidationError", err)
+			}
+			if cfg == nil {
+				t.Error("Load() config = nil, want the invalid config")
+			}
+			if len(validationErr.Problems) != len(tt.want) {
+				t.Errorf("Load() problems = %q, want %d problems", validationErr.Problems, len(tt.want))
+			}
+			for _, want := range tt.want {
+				if !slices.ContainsFunc(validationErr.Problems, func(p string) bool { return strings.Contains(p, want) }) {
+					t.Errorf("Load() problems = %q, want %q", validationErr.Problems, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		env    map[string]string
+		want   string
+	}{
+		{
+			name:   "invalid JSON",
+			config: `{"llmProviderName": `,
+			want:   "failed to parse config file",
+		},
+		{
+			name:   "invalid value in environment variable",
+			config: `{}`,
+			env:    map[string]string{EnvName("port"): "eighty"},
+			want:   "invalid value for port",
+		},
+		{
+			name:   "missing reference",
+			config: `{"llmApiKey": "${TEST_LOAD_MISSING}"}`,
+			want:   "failed to resolve ${TEST_LOAD_MISSING} in llmApiKey",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := writeFile(t, t.TempDir(), "config.json", tt.config)
+			_, err := Load(nil, path, "")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// fileRefPrefix is the prefix of a value that refers to the content of a file.
+const fileRefPrefix = "file://"
+
+// ReferenceError is returned when a reference in the configuration cannot be resolved.
+type ReferenceError struct {
+	// Key is the path of the key that contains the reference. e.g. `mcpServers.github.env.GITHUB_TOKEN`
+	Key string
+	// Ref is the unresolved reference. e.g. `${GITHUB_TOKEN}`
+	Ref string
+	Err error
+}
+
+func (e *ReferenceError) Error() string {
+	return fmt.Sprintf("failed to resolve %s in %s: %v", e.Ref, e.Key, e.Err)
+}
+
+func (e *ReferenceError) Unwrap() error {
+	return e.Err
+}
+
+// ErrEnvNotSet is returned when a referenced environment variable is not set.
+var ErrEnvNotSet = errors.New("environment variable is not set")
+
+// interpolate resolves references in the secret values of cfg.
+//
+//   - `${ENV_VAR}` is replaced with the value of the environment variable. `$${` is an escaped `${`.
+//   - `file:///path/to/file` is replaced with the content of the file, without trailing newlines.
+func interpolate(cfg *Config) error {
+	var err error
+	if cfg.LLMApiKey, err = resolve("llmApiKey", cfg.LLMApiKey); err != nil {
+		return err
+	}
+	if cfg.SlackBotToken, err = resolve("slackBotToken", cfg.SlackBotToken); err != nil {
+		return err
+	}
+	if cfg.SackSinginSecret, err = resolve("slackSigninSecret", cfg.SackSinginSecret); err != nil {
+		return err
+	}
+	for name, server := range cfg.MCPServers {
+		for k, v := range server.Env {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			if server.Env[k], err = resolve(fmt.Sprintf("mcpServers.%s.env.%s", name, k), s); err != nil {
+				return err
+			}
+		}
+		for k, v := range server.Headers {
+			if server.Headers[k], err = resolve(fmt.Sprintf("mcpServers.%s.headers.%s", name, k), v); err != nil {
+				return err
+			}
+		}
+		if server.BearerToken, err = resolve(fmt.Sprintf("mcpServers.%s.bearerToken", name), server.BearerToken); err != nil {
+			return err
+		}
+		if server.OAuth != nil {
+			oauth := *server.OAuth
+			if oauth.ClientSecret, err = resolve(fmt.Sprintf("mcpServers.%s.oauth.clientSecret", name), oauth.ClientSecret); err != nil {
+				return err
+			}
+			if oauth.RefreshToken, err = resolve(fmt.Sprintf("mcpServers.%s.oauth.refreshToken", name), oauth.RefreshToken); err != nil {
+				return err
+			}
+			server.OAuth = &oauth
+		}
+		cfg.MCPServers[name] = server
+	}
+	if cfg.Channels != nil {
+		for channel, profile := range cfg.Channels.Profiles {
+			if profile.LLMApiKey, err = resolve(fmt.Sprintf("channels.profiles.%s.llmApiKey", channel), profile.LLMApiKey); err != nil {
+				return err
+			}
+			cfg.Channels.Profiles[channel] = profile
+		}
+	}
+	return nil
+}
+
+// resolve resolves the references in value.
+//
+//   - key: The path of the key for error reporting.
+//   - value: The value that may contain references.
+func resolve(key, value string) (string, error) {
+	if path, ok := strings.CutPrefix(value, fileRefPrefix); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", &ReferenceError{Key: key, Ref: value, Err: err}
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(value, "${")
+		if i == -1 {
+			b.WriteString(value)
+			return b.String(), nil
+		}
+		if i > 0 && value[i-1] == '$' {
+			b.WriteString(value[:i-1])
+			b.WriteString("${")
+			value = value[i+2:]
+			continue
+		}
+		end := strings.IndexByte(value[i:], '}')
+		if end == -1 {
+			return "", &ReferenceError{Key: key, Ref: value[i:], Err: errors.New("unterminated reference")}
+		}
+		name := value[i+2 : i+end]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", &ReferenceError{Key: key, Ref: value[i : i+end+1], Err: ErrEnvNotSet}
+		}
+		b.WriteString(value[:i])
+		b.WriteString(v)
+		value = value[i+end+1:]
+	}
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_RESOLVE_TOKEN", "from-env")
+	t.Setenv("TEST_RESOLVE_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantRef string
+		wantErr error
+	}{
+		{name: "plain", value: "plain-value", want: "plain-value"},
+		{name: "empty", value: "", want: ""},
+		{name: "env", value: "${TEST_RESOLVE_TOKEN}", want: "from-env"},
+		{name: "env in text", value: "Bearer ${TEST_RESOLVE_TOKEN}!", want: "Bearer from-env!"},
+		{name: "multiple env", value: "${TEST_RESOLVE_TOKEN}:${TEST_RESOLVE_TOKEN}", want: "from-env:from-env"},
+		{name: "empty env", value: "x${TEST_RESOLVE_EMPTY}y", want: "xy"},
+		{name: "escaped", value: "$${TEST_RESOLVE_TOKEN}", want: "${TEST_RESOLVE_TOKEN}"},
+		{name: "escaped and env", value: "$${literal} ${TEST_RESOLVE_TOKEN}", want: "${literal} from-env"},
+		{name: "dollar without brace", value: "pa$$word", want: "pa$$word"},
+		{name: "file", value: "file://" + secretFile, want: "from-file"},
+		{name: "file reference only as the whole value", value: "${TEST_RESOLVE_TOKEN}file://" + secretFile, want: "from-envfile://" + secretFile},
+		{
+			name:    "missing env",
+			value:   "Bearer ${TEST_RESOLVE_MISSING}",
+			wantRef: "${TEST_RESOLVE_MISSING}",
+			wantErr: ErrEnvNotSet,
+		},
+		{
+			name:    "missing file",
+			value:   "file://" + filepath.Join(dir, "missing"),
+			wantRef: "file://" + filepath.Join(dir, "missing"),
+			wantErr: os.ErrNotExist,
+		},
+		{
+			name:    "unterminated",
+			value:   "${TEST_RESOLVE_TOKEN",
+			wantRef: "${TEST_RESOLVE_TOKEN",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolve("mcpServers.github.env.GITHUB_TOKEN", tt.value)
+			if tt.wantRef == "" {
+				if err != nil {
+					t.Fatalf("resolve() error = %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("resolve() = %q, want %q", got, tt.want)
+				}
+				return
+			}
+
+			var refErr *ReferenceError
+			if !errors.As(err, &refErr) {
+				t.Fatalf("resolve() error = %v, want *ReferenceError", err)
+			}
+			if refErr.Key != "mcpServers.github.env.GITHUB_TOKEN" || refErr.Ref != tt.wantRef {
+				t.Errorf("resolve() error key, ref = %q, %q, want %q, %q", refErr.Key, refErr.Ref, "mcpServers.github.env.GITHUB_TOKEN", tt.wantRef)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("resolve() error = %v, want %v", err, tt.wantErr)
+			}
+			// the error names the key and the reference to fix
+			if msg := err.Error(); !strings.Contains(msg, refErr.Key) || !strings.Contains(msg, tt.wantRef) {
+				t.Errorf("resolve() error = %q, want the key and the reference", msg)
+			}
+		})
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("TEST_INTERPOLATE_KEY", "resolved")
+	cfg := &Config{
+		LLMApiKey:        "${TEST_INTERPOLATE_KEY}",
+		SlackBotToken:    "xoxb-${TEST_INTERPOLATE_KEY}",
+		SackSinginSecret: "$${TEST_INTERPOLATE_KEY}",
+		MCPServers: map[string]MCPServerConfig{
+			"github": {
+				Env:         map[string]any{"TOKEN": "${TEST_INTERPOLATE_KEY}", "DEBUG": true},
+				Headers:     map[string]string{"X-Key": "${TEST_INTERPOLATE_KEY}"},
+				BearerToken: "${TEST_INTERPOLATE_KEY}",
+				OAuth:       &OAuthConfig{ClientSecret: "${TEST_INTERPOLATE_KEY}", RefreshToken: "${TEST_INTERPOLATE_KEY}"},
+			},
+		},
+		Channels: &ChannelsConfig{Profiles: map[string]ProfileConfig{
+			"C1": {LLMApiKey: "${TEST_INTERPOLATE_KEY}"},
+		}},
+	}
+	if err := interpolate(cfg); err != nil {
+		t.Fatalf("interpolate() error = %v", err)
+	}
+
+	server := cfg.MCPServers["github"]
+	tests := []struct {
+		key  string
+		got  any
+		want any
+	}{
+		{key: "llmApiKey", got: cfg.LLMApiKey, want: "resolved"},
+		{key: "slackBotToken", got: cfg.SlackBotToken, want: "xoxb-resolved"},
+		{key: "slackSigninSecret", got: cfg.SackSinginSecret, want: "${TEST_INTERPOLATE_KEY}"},
+		{key: "mcpServers.github.env.TOKEN", got: server.Env["TOKEN"], want: "resolved"},
+		{key: "mcpServers.github.env.DEBUG", got: server.Env["DEBUG"], want: true},
+		{key: "mcpServers.github.headers.X-Key", got: server.Headers["X-Key"], want: "resolved"},
+		{key: "mcpServers.github.bearerToken", got: server.BearerToken, want: "resolved"},
+		{key: "mcpServers.github.oauth.clientSecret", got: server.OAuth.ClientSecret, want: "resolved"},
+		{key: "mcpServers.github.oauth.refreshToken", got: server.OAuth.RefreshToken, want: "resolved"},
+		{key: "channels.profiles.C1.llmApiKey", got: cfg.Channels.Profiles["C1"].LLMApiKey, want: "resolved"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.key, tt.got, tt.want)
+		}
+	}
+}
+
+func TestInterpolate_MissingEnv(t *testing.T) {
+	cfg := &Config{MCPServers: map[string]MCPServerConfig{
+		"github": {Headers: map[string]string{"Authorization": "Bearer ${TEST_INTERPOLATE_MISSING}"}},
+	}}
+	err := interpolate(cfg)
+	var refErr *ReferenceError
+	if !errors.As(err, &refErr) {
+		t.Fatalf("interpolate() error = %v, want *ReferenceError", err)
+	}
+	if refErr.Key != "mcpServers.github.headers.Authorization" {
+		t.Errorf("interpolate() error key = %q, want %q", refErr.Key, "mcpServers.github.headers.Authorization")
+	}
+}
@@ -0,0 +1,461 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+const (
+	LLMProviderAnthropic = "anthropic"
+	LLMProviderOpenAI    = "openai"
+	LLMProviderGoogle    = "google"
+)
+
+// llmProviders is the list of supported LLM providers.
+var llmProviders = []string{LLMProviderAnthropic, LLMProviderOpenAI, LLMProviderGoogle}
+
+// transports is the list of supported transport types of MCP servers.
+var transports = []string{TransportStdio, TransportSSE, TransportStreamableHTTP}
+
+// oauthGrants is the list of supported OAuth grant types.
+var oauthGrants = []string{OAuthGrantClientCredentials, OAuthGrantRefreshToken, OAuthGrantAuthorizationCode}
+
+// ValidationError is returned when the configuration has one or more problems.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid config:")
+	for _, p := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// Validate reports all problems in the configuration at once.
+// returns *ValidationError if the configuration is invalid, otherwise nil.
+func (c *Config) Validate() error {
+	var problems []string
+	problemf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case c.LLMProviderName == "":
+		problemf("llmProviderName is required")
+	case !slices.Contains(llmProviders, c.LLMProviderName):
+		problemf("llmProviderName %q is not supported. must be one of %s", c.LLMProviderName, strings.Join(llmProviders, ", "))
+	case c.LLMProviderName == LLMProviderGoogle && c.LLMModelName == "":
+		problemf("llmModelName is required for google")
+	}
+	if c.SlackBotToken == "" {
+		problemf("slackBotToken is required")
+	}
+	if c.SackSinginSecret == "" {
+		problemf("slackSigninSecret is required")
+	}
+	if c.TimeoutNs < 0 {
+		problemf("timeoutNs must not be negative: %d", c.TimeoutNs)
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		problemf("port must be between 0 and 65535: %d", c.Port)
+	}
+	for _, name := range sortedKeys(c.MCPServers) {
+		server := c.MCPServers[name]
+		problems = append(problems, server.validate(fmt.Sprintf("mcpServers.%s", name))...)
+		if server.PerUser && c.PublicURL == "" {
+			problemf("publicUrl is required for mcpServers.%s.perUser", name)
+		}
+		if server.Sampling != nil && c.LLMModelName == "" {
+			problemf("llmModelName is required for mcpServers.%s.sampling", name)
+		}
+	}
+	if c.PublicURL != "" {
+		if u, err := url.Parse(c.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problemf("publicUrl must be http or https URL: %s", c.PublicURL)
+		}
+	}
+	problems = append(problems, c.RateLimit.validate("rateLimit")...)
+	problems = append(problems, c.History.validate("history")...)
+	if c.Access != nil {
+		problems = append(problems, c.Access.validate("access")...)
+	}
+	if c.Channels != nil {
+		problems = append(problems, c.Channels.validate("channels", c.LLMProviderName)...)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// validate reports the problems in the MCP server configuration.
+func (c MCPServerConfig) validate(key string) (problems []string) {
+	problemf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	switch c.Transport() {
+	case TransportStdio:
+		switch c.Command {
+		case "":
+			problemf("%s.command is required", key)
+		case "sse_server":
+			problemf(`%s.command "sse_server" is no longer supported. use "type": "sse" and "url" instead`, key)
+		}
+		if c.URL != "" {
+			problemf("%s.url is not available for %s transport", key, TransportStdio)
+		}
+		if c.OAuth != nil {
+			problemf("%s.oauth is not available for %s transport", key, TransportStdio)
+		}
+		if c.PerUser {
+			problemf("%s.perUser is not available for %s transport", key, TransportStdio)
+		}
+		for _, k := range sortedKeys(c.Env) {
+			switch c.Env[k].(type) {
+			case string, float64, bool:
+			default:
+				problemf("%s.env.%s must be a string, number or boolean", key, k)
+			}
+		}
+	case TransportSSE, TransportStreamableHTTP:
+		u, err := url.Parse(c.URL)
+		switch {
+		case c.URL == "":
+			problemf("%s.url is required for %s transport", key, c.Transport())
+		case err != nil:
+			problemf("%s.url is invalid: %v", key, err)
+		case u.Scheme != "http" && u.Scheme != "https":
+			problemf("%s.url must be http or https: %s", key, c.URL)
+		}
+		if c.Command != "" {
+			problemf("%s.command is not available for %s transport", key, c.Transport())
+		}
+		if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+			problemf("%s.tls.certFile and %s.tls.keyFile must be set together", key, key)
+		}
+		if c.Listen && c.Transport() != TransportStreamableHTTP {
+			problemf("%s.listen is only available for %s transport", key, TransportStreamableHTTP)
+		}
+		if c.OAuth != nil {
+			if c.BearerToken != "" {
+				problemf("%s.bearerToken and %s.oauth must not be set together", key, key)
+			}
+			for k := range c.Headers {
+				if strings.EqualFold(k, "Authorization") {
+					problemf("%s.headers.%s and %s.oauth must not be set together", key, k, key)
+				}
+			}
+			problems = append(problems, c.OAuth.validate(key+".oauth")...)
+		}
+		switch {
+		case c.PerUser && (c.OAuth == nil || c.OAuth.Grant() != OAuthGrantAuthorizationCode):
+			problemf("%s.perUser requires %s.oauth with %s grant", key, key, OAuthGrantAuthorizationCode)
+		case c.PerUser && c.OAuth.TokenFile != "":
+			problemf("%s.oauth.tokenFile is not available for perUser. use tokenDir instead", key)
+		case !c.PerUser && c.OAuth != nil && c.OAuth.Grant() == OAuthGrantAuthorizationCode:
+			problemf("%s.oauth %s grant is only available for perUser", key, OAuthGrantAuthorizationCode)
+		case !c.PerUser && c.OAuth != nil && c.OAuth.TokenDir != "":
+			problemf("%s.oauth.tokenDir is only available for perUser", key)
+		}
+		if c.PerUser && c.Required {
+			problemf("%s.required is not available for perUser", key)
+		}
+	default:
+		problemf("%s.type %q is not supported. must be one of %s", key, c.Type, strings.Join(transports, ", "))
+	}
+	if c.Sampling != nil {
+		if c.Transport() == TransportSSE {
+			problemf("%s.sampling is not available for %s transport", key, TransportSSE)
+		}
+		if c.Sampling.MaxTokens < 0 {
+			problemf("%s.sampling.maxTokens must not be negative", key)
+		}
+	}
+	if c.Roots != nil {
+		if c.Transport() == TransportSSE {
+			problemf("%s.roots is not available for %s transport", key, TransportSSE)
+		}
+		problems = append(problems, validateRoots(key+".roots.default", c.Roots.Default)...)
+		for _, channel := range sortedKeys(c.Roots.Channels) {
+			problems = append(problems, validateRoots(fmt.Sprintf("%s.roots.channels.%s", key, channel), c.Roots.Channels[channel])...)
+		}
+	}
+	if c.Tools != nil {
+		problems = append(problems, c.Tools.validate(key+".tools")...)
+	}
+	return problems
+}
+
+// validate reports the problems in the tools configuration.
+func (c ToolsConfig) validate(key string) (problems []string) {
+	problemf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	for i, pattern := range c.Include {
+		if _, err := path.Match(pattern, ""); err != nil {
+			problemf("%s.include[%d] is not a valid glob pattern: %s", key, i, pattern)
+		}
+	}
+	for i, pattern := range c.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			problemf("%s.exclude[%d] is not a valid glob pattern: %s", key, i, pattern)
+		}
+	}
+	for i, pattern := range c.Approval {
+		if _, err := path.Match(pattern, ""); err != nil {
+			problemf("%s.approval[%d] is not a valid glob pattern: %s", key, i, pattern)
+		}
+	}
+	aliased := make(map[string]string)
+	for _, tool := range sortedKeys(c.Overrides) {
+		alias := c.Overrides[tool].Alias
+		if alias == "" {
+			continue
+		}
+		if other, ok := aliased[alias]; ok {
+			problemf("%s.overrides.%s.alias %q is already used by %s", key, tool, alias, other)
+			continue
+		}
+		aliased[alias] = tool
+	}
+	return problems
+}
+
+// validateRoots reports the problems in the roots.
+func validateRoots(key string, roots []RootConfig) (problems []string) {
+	for i, root := range roots {
+		if u, err := url.Parse(root.URI); err != nil || u.Scheme == "" {
+			problems = append(problems, fmt.Sprintf("%s[%d].uri must be an absolute URI, such as file:///path: %s", key, i, root.URI))
+		}
+	}
+	return problems
+}
+
+// validate reports the problems in the access configuration.
+func (c AccessConfig) validate(key string) (problems []string) {
+	problemf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	for _, name := range sortedKeys(c.Roles) {
+		role := c.Roles[name]
+		if name == AnyRole {
+			problemf("%s.roles.%s is reserved for all users", key, name)
+		}
+		if len(role.Users) == 0 && len(role.Groups) == 0 {
+			problemf("%s.roles.%s must have users or groups", key, name)
+		}
+	}
+	for i, policy := range c.Policies {
+		if len(policy.Roles) == 0 {
+			problemf("%s.policies[%d].roles is required", key, i)
+		}
+		for _, role := range policy.Roles {
+			if _, ok := c.Roles[role]; !ok && role != AnyRole {
+				problemf("%s.policies[%d].roles has undefined role: %s", key, i, role)
+			}
+		}
+		if len(policy.Servers) == 0 {
+			problemf("%s.policies[%d].servers is required", key, i)
+		}
+		for j, pattern := range policy.Servers {
+			if _, err := path.Match(pattern, ""); err != nil {
+				problemf("%s.policies[%d].servers[%d] is not a valid glob pattern: %s", key, i, j, pattern)
+			}
+		}
+		for j, pattern := range policy.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				problemf("%s.policies[%d].tools[%d] is not a valid glob pattern: %s", key, i, j, pattern)
+			}
+		}
+	}
+	return problems
+}
+
+// validate reports the problems in the channels configuration.
+//
+//   - llmProviderName: The top-level LLM provider, which the profiles inherit the settings of.
+func (c ChannelsConfig) validate(key, llmProviderName string) (problems []string) {
+	problemf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	for _, channel := range sortedKeys(c.Profiles) {
+		profile := c.Profiles[channel]
+		profileKey := fmt.Sprintf("%s.profiles.%s", key, channel)
+		if !c.Allows(channel) {
+			problemf("%s is the profile of the channel the bot does not respond in", profileKey)
+		}
+		switch {
+		case profile.LLMProviderName == "" || profile.LLMProviderName == llmProviderName:
+		case !slices.Contains(llmProviders, profile.LLMProviderName):
+			problemf("%s.llmProviderName %q is not supported. must be one of %s", profileKey, profile.LLMProviderName, strings.Join(llmProviders, ", "))
+		case profile.LLMApiKey == "":
+			problemf("%s.llmApiKey is required for the provider other than llmProviderName", profileKey)
+		}
+		for i, pattern := range profile.Servers {
+			if _, err := path.Match(pattern, ""); err != nil {
+				problemf("%s.servers[%d] is not a valid glob pattern: %s", profileKey, i, pattern)
+			}
+		}
+		for i, pattern := range profile.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				problemf("%s.tools[%d] is not a valid glob pattern: %s", profileKey, i, pattern)
+			}
+		}
+		if profile.RateLimit != nil {
+			problems = append(problems, profile.RateLimit.validate(profileKey+".rateLimit")...)
+		}
+		if profile.History != nil {
+			problems = append(problems, profile.History.validate(profileKey+".history")...)
+		}
+	}
+	return problems
+}
+
+// validate reports the problems in the OAuth configuration.
+func (c OAuthConfig) validate(key string) (problems []string) {
+	problemf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if c.ClientID == "" {
+		problemf("%s.clientId is required", key)
+	}
+	switch c.Grant() {
+	case OAuthGrantClientCredentials:
+		if c.ClientSecret == "" {
+			problemf("%s.clientSecret is required for %s grant", key, OAuthGrantClientCredentials)
+		}
+	case OAuthGrantRefreshToken:
+		if c.RefreshToken == "" && c.TokenFile == "" {
+			problemf("%s.refreshToken or %s.tokenFile is required for %s grant", key, key, OAuthGrantRefreshToken)
+		}
+	case OAuthGrantAuthorizationCode:
+		if c.RefreshToken != "" {
+			problemf("%s.refreshToken is not available for %s grant", key, OAuthGrantAuthorizationCode)
+		}
+	default:
+		problemf("%s.grantType %q is not supported. must be one of %s", key, c.GrantType, strings.Join(oauthGrants, ", "))
+	}
+	if c.AuthServerMetadataURL != "" {
+		if u, err := url.Parse(c.AuthServerMetadataURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			problemf("%s.authServerMetadataUrl must be http or https URL: %s", key, c.AuthServerMetadataURL)
+		}
+	}
+	return problems
+}
+
+// validate reports the problems in the rate limit configuration.
+func (c RateLimitConfig) validate(key string) (problems []string) {
+	if !c.Enable {
+		return nil
+	}
+	if c.Limit <= 0 {
+		problems = append(problems, fmt.Sprintf("%s.limit must be greater than 0: %v", key, c.Limit))
+	}
+	if c.Burst <= 0 {
+		problems = append(problems, fmt.Sprintf("%s.burst must be greater than 0: %d", key, c.Burst))
+	}
+	if c.ExpressIn < 0 {
+		problems = append(problems, fmt.Sprintf("%s.expiresIn must not be negative: %d", key, c.ExpressIn))
+	}
+	return problems
+}
+
+// validate reports the problems in the history configuration.
+func (c HistoryConfig) validate(key string) (problems []string) {
+	if c.MaxTokens < 0 {
+		problems = append(problems, fmt.Sprintf("%s.maxTokens must not be negative: %d", key, c.MaxTokens))
+	}
+	return problems
+}
+
+// unknownFields returns the paths of the keys in data that do not exist in t.
+func unknownFields(data []byte, t reflect.Type, key string) ([]string, error) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return unknownFieldsOf(v, t, key), nil
+}
+
+func unknownFieldsOf(v any, t reflect.Type, key string) (unknown []string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	join := func(k string) string {
+		if key == "" {
+			return k
+		}
+		return key + "." + k
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		for _, k := range sortedKeys(obj) {
+			field, ok := fieldByJSONKey(t, k)
+			if !ok {
+				unknown = append(unknown, join(k))
+				continue
+			}
+			unknown = append(unknown, unknownFieldsOf(obj[k], field.Type, join(k))...)
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		for _, k := range sortedKeys(obj) {
+			unknown = append(unknown, unknownFieldsOf(obj[k], t.Elem(), join(k))...)
+		}
+	case reflect.Slice:
+		arr, ok := v.([]any)
+		if !ok {
+			return nil
+		}
+		for i, e := range arr {
+			unknown = append(unknown, unknownFieldsOf(e, t.Elem(), fmt.Sprintf("%s[%d]", key, i))...)
+		}
+	}
+	return unknown
+}
+
+// fieldByJSONKey finds the field of t decoded from the JSON key, ignoring case as the decoder does.
+func fieldByJSONKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Watch polls the config file and the secrets directory every interval,
+// and sends to the returned channel when any of them changed.
+// The channel is closed when ctx is done.
+func Watch(ctx context.Context, interval time.Duration, path, secretsDir string) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		last := fingerprint(path, secretsDir)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				current := fingerprint(path, secretsDir)
+				if current == last {
+					continue
+				}
+				last = current
+				slog.InfoContext(ctx, "config changed", slog.String("path", path), slog.String("secretsDir", secretsDir))
+				select {
+				case ch <- struct{}{}:
+				default:
+					// a reload is already pending
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// fingerprint returns a string that changes when the config file or any file in the secrets directory is modified.
+func fingerprint(path, secretsDir string) string {
+	var fp string
+	stat := func(name string) {
+		// os.Stat follows symlinks, so that atomic updates of mounted secrets are detected.
+		info, err := os.Stat(name)
+		if err != nil {
+			fp += fmt.Sprintf("%s:-;", name)
+			return
+		}
+		fp += fmt.Sprintf("%s:%d:%d;", name, info.ModTime().UnixNano(), info.Size())
+	}
+	if path != "" {
+		stat(path)
+	}
+	if secretsDir != "" {
+		entries, _ := os.ReadDir(secretsDir)
+		for _, entry := range entries {
+			stat(filepath.Join(secretsDir, entry.Name()))
+		}
+	}
+	return fp
+}
@@ -0,0 +1,200 @@
+package interfaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/slack-go/slack"
+)
+
+// PromptUseCase represents the use-case for running the prompts of MCP servers.
+type PromptUseCase interface {
+	// ListPrompts returns the prompts of the MCP servers available to the user keyed by server name.
+	ListPrompts(ctx context.Context, profile config.Profile, user, channel string) map[string][]mcp.Prompt
+	// ExecutePrompt fetches the prompt of the MCP server, and runs its messages through the LLM in a new thread.
+	ExecutePrompt(sessionCtx context.Context, profile config.Profile, user, channel, server, name string, arguments map[string]string) error
+}
+
+// commandUsage is the usage of the slash command.
+const commandUsage = "Usage:\n" +
+	"• `%[1]s prompt` lists the prompts of all MCP servers\n" +
+	"• `%[1]s prompt <server>` lists the prompts of the server\n" +
+	"• `%[1]s prompt <server> <name> [key=value ...]` runs the prompt in a new thread. quote the value containing spaces, like `key=\"a b\"`"
+
+var errUnclosedQuote = errors.New("unclosed quote")
+
+// NewCommandHandler returns handler for Slack slash commands.
+//
+//   - rootCtx: The context representing the application's lifecycle.
+//   - uc: The use-case for running the prompts of MCP servers.
+func NewCommandHandler(rootCtx context.Context, uc PromptUseCase) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		command, ok := commandFromContext(c)
+		if !ok {
+			return echo.NewHTTPError(http.StatusBadRequest)
+		}
+		user, err := userFromContext(c)
+		if err != nil {
+			return err
+		}
+		profile, _ := profileFromContext(c)
+		slog.Info("command received", slog.String("user_id", user.ID), slog.String("command", command.Command), slog.String("text", command.Text))
+
+		args, err := splitArgs(command.Text)
+		if err != nil {
+			return c.String(http.StatusOK, fmt.Sprintf("⚠️ %s\n%s", err.Error(), fmt.Sprintf(commandUsage, command.Command)))
+		}
+		if len(args) == 0 || args[0] != "prompt" {
+			return c.String(http.StatusOK, fmt.Sprintf(commandUsage, command.Command))
+		}
+		args = args[1:]
+
+		// the response must be returned within 3 seconds, so the rest is responded to response_url
+		session := newSession(rootCtx, user)
+		if len(args) < 2 {
+			go func() {
+				defer session.cancel()
+				var server string
+				if len(args) == 1 {
+					server = args[0]
+				}
+				respond(session.ctx, command, formatPrompts(command.Command, server, uc.ListPrompts(session.ctx, profile, user.ID, command.ChannelID)))
+			}()
+			return c.String(http.StatusOK, "⌛ Listing prompts...")
+		}
+
+		server, name := args[0], args[1]
+		arguments := make(map[string]string, len(args)-2)
+		for _, arg := range args[2:] {
+			key, value, ok := strings.Cut(arg, "=")
+			if !ok || key == "" {
+				return c.String(http.StatusOK, fmt.Sprintf("⚠️ invalid argument `%s`. must be key=value\n%s", arg, fmt.Sprintf(commandUsage, command.Command)))
+			}
+			arguments[key] = value
+		}
+		go func() {
+			defer session.cancel()
+			if err := uc.ExecutePrompt(session.ctx, profile, user.ID, command.ChannelID, server, name, arguments); err != nil {
+				slog.Error("failed to execute prompt", slog.String("error", err.Error()))
+				respond(session.ctx, command, fmt.Sprintf("⚠️ Failed to run `%s` prompt of `%s`: %s", name, server, err.Error()))
+			}
+		}()
+		return c.String(http.StatusOK, fmt.Sprintf("⌛ Running `%s` prompt of `%s`...", name, server))
+	}
+}
+
+// respond sends the message visible only to the user who runs the command.
+func respond(ctx context.Context, command slack.SlashCommand, text string) {
+	if err := slack.PostWebhookContext(ctx, command.ResponseURL, &slack.WebhookMessage{
+		Text:         text,
+		ResponseType: slack.ResponseTypeEphemeral,
+	}); err != nil {
+		slog.Error("failed to respond to command", slog.String("error", err.Error()))
+	}
+}
+
+// formatPrompts formats the prompts with their arguments as a Slack message.
+// if server is not empty, only the prompts of the server are formatted.
+func formatPrompts(command, server string, prompts map[string][]mcp.Prompt) string {
+	servers := make([]string, 0, len(prompts))
+	for name := range prompts {
+		if server == "" || name == server {
+			servers = append(servers, name)
+		}
+	}
+	if len(servers) == 0 {
+		if server != "" {
+			return fmt.Sprintf("No prompts are available for `%s`.", server)
+		}
+		return "No prompts are available."
+	}
+	slices.Sort(servers)
+	var b strings.Builder
+	for _, name := range servers {
+		fmt.Fprintf(&b, "*%s*\n", name)
+		for _, prompt := range prompts[name] {
+			fmt.Fprintf(&b, "• `%s prompt %s %s", command, name, prompt.Name)
+			for _, arg := range prompt.Arguments {
+				if arg.Required {
+					fmt.Fprintf(&b, " %s=…", arg.Name)
+				} else {
+					fmt.Fprintf(&b, " [%s=…]", arg.Name)
+				}
+			}
+			b.WriteString("`")
+			if prompt.Description != "" {
+				fmt.Fprintf(&b, " %s", prompt.Description)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// splitArgs splits the text of the command into arguments separated by spaces.
+// spaces in double quotes are kept, including the smart quotes Slack may convert to.
+func splitArgs(text string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		quoted  bool
+		inArg   bool
+	)
+	for _, r := range text {
+		switch {
+		case r == '"' || r == '“' || r == '”':
+			quoted = !quoted
+			inArg = true
+		case unicode.IsSpace(r) && !quoted:
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, errUnclosedQuote
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// handleCommandError responds to the slash command with the error, visible only to the user.
+// the response must be 200 OK for Slack to show it.
+func handleCommandError(err error, c echo.Context, command slack.SlashCommand) {
+	if c.Response().Committed {
+		return
+	}
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) {
+		slog.WarnContext(c.Request().Context(), "occurred unexpected error", slog.String("error", err.Error()))
+		c.String(http.StatusOK, "⚠️ Occured unexpected error")
+		return
+	}
+	slog.WarnContext(c.Request().Context(), "occurred *echo.HTTPError", slog.String("error", httpErr.Error()), slog.String("command", command.Command))
+	switch httpErr.Code {
+	case http.StatusUnauthorized:
+		c.String(http.StatusOK, "🫵 Unauthorized")
+	case http.StatusForbidden:
+		c.String(http.StatusOK, "⛔ You are not allowed to perform this operation. Please contact the bot administrator.")
+	case http.StatusTooManyRequests:
+		c.String(http.StatusOK, "🙌 You have reached your rate limit. Please try again later.")
+	default:
+		c.String(http.StatusOK, "⚠️ Occured unexpected error")
+	}
+}
@@ -0,0 +1,41 @@
+package interfaces
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []string
+		wantErr error
+	}{
+		{name: "empty", text: "", want: nil},
+		{name: "spaces only", text: "  \t ", want: nil},
+		{name: "words", text: "prompt github review_pr", want: []string{"prompt", "github", "review_pr"}},
+		{name: "repeated spaces", text: "  prompt   github\treview_pr  ", want: []string{"prompt", "github", "review_pr"}},
+		{name: "key value", text: "repo=owner/repo pr=12", want: []string{"repo=owner/repo", "pr=12"}},
+		{name: "quoted value", text: `title="fix the bug" pr=12`, want: []string{"title=fix the bug", "pr=12"}},
+		{name: "quoted argument", text: `"key=a b"`, want: []string{"key=a b"}},
+		{name: "smart quotes", text: "title=“fix the bug”", want: []string{"title=fix the bug"}},
+		{name: "empty value", text: "key= other=1", want: []string{"key=", "other=1"}},
+		{name: "empty quoted value", text: `key="" other=1`, want: []string{"key=", "other=1"}},
+		{name: "empty quoted argument", text: `"" x`, want: []string{"", "x"}},
+		{name: "equals in value", text: "query=a=b filter=\"x = y\"", want: []string{"query=a=b", "filter=x = y"}},
+		{name: "unclosed quote", text: `title="fix the bug`, wantErr: errUnclosedQuote},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitArgs(tt.text)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("splitArgs(%q) error = %v, want %v", tt.text, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitArgs(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -11,6 +11,8 @@ import (
 
 	"github.com/goccy/go-json"
 	"github.com/labstack/echo/v4"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 )
 
@@ -19,12 +21,22 @@ type UseCase interface {
 	// Execute handles LLM interactions and Slack message updates.
 	//
 	// 	- sessionCtx: context representing the session for the operation.
+	// 	- profile: The profile of the channel, which the session runs with.
 	// 	- channel: The Slack channel ID where the message will be posted.
 	// 	- threadTs: The timestamp of the thread to reply to.
 	// 	- prompt: The prompt to send to the LLM.
-	Execute(sessionCtx context.Context, user, channel, threadTs, prompt string) error
+	Execute(sessionCtx context.Context, profile config.Profile, user, channel, threadTs, prompt string) error
+	// Stop stops the session in the thread started by the user.
+	//
+	// 	- user: The Slack user ID who stops the session.
+	// 	- channel: The Slack channel ID of the thread.
+	// 	- threadTs: The timestamp of the thread.
+	Stop(ctx context.Context, user, channel, threadTs string) error
 }
 
+// reactionStop is the reaction to stop the session in the thread.
+const reactionStop = "raised_hand"
+
 // NewHandler returns handler for Slack events.
 //
 //   - ctx: The context representing the application's lifecycle.
@@ -49,6 +61,7 @@ func NewHandler(
 		case slackevents.CallbackEvent:
 			switch innerEvent := event.InnerEvent.Data.(type) {
 			case *slackevents.AppMentionEvent:
+				profile, _ := profileFromContext(c)
 				go func() {
 					untypedSession, ok := sessions.Load(sessionKey(innerEvent.Channel, innerEvent.TimeStamp, innerEvent.User))
 					if !ok {
@@ -68,7 +81,7 @@ func NewHandler(
 					prompt := promptFromMention(innerEvent)
 
 					select {
-					case errCh <- uc.Execute(session.ctx, innerEvent.User, innerEvent.Channel, innerEvent.TimeStamp, prompt):
+					case errCh <- uc.Execute(session.ctx, profile, innerEvent.User, innerEvent.Channel, innerEvent.TimeStamp, prompt):
 						if err := <-errCh; err != nil {
 							slog.Error("failed to execute", slog.String("error", err.Error()))
 						}
@@ -82,12 +95,55 @@ func NewHandler(
 					}
 				}()
 				return c.NoContent(http.StatusAccepted)
+			case *slackevents.ReactionAddedEvent:
+				if innerEvent.Reaction != reactionStop || innerEvent.Item.Type != "message" {
+					return c.NoContent(http.StatusOK)
+				}
+				// the reactions by the users other than the one who starts the session are ignored
+				if err := uc.Stop(c.Request().Context(), innerEvent.User, innerEvent.Item.Channel, innerEvent.Item.Timestamp); err != nil {
+					slog.Debug("failed to stop session", slog.String("channel", innerEvent.Item.Channel), slog.String("ts", innerEvent.Item.Timestamp), slog.String("error", err.Error()))
+				}
+				return c.NoContent(http.StatusOK)
 			}
 		}
 		return nil
 	}
 }
 
+// AccountLinker represents the linking of the accounts of MCP servers to Slack users.
+type AccountLinker interface {
+	// Link completes linking the account with the authorization code issued for the link identified by state.
+	// returns the name of the MCP server and the Slack user ID of the linked account.
+	Link(ctx context.Context, state, code string) (server, user string, err error)
+}
+
+// NewLinkHandler returns handler for the redirection from the authorization server on linking an account.
+//
+//   - linker: The linking of the accounts.
+//   - client: The Slack client to notify the user of the linked account.
+func NewLinkHandler(linker AccountLinker, client *slack.Client) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if errorCode := c.QueryParam("error"); errorCode != "" {
+			slog.WarnContext(c.Request().Context(), "authorization is denied",
+				slog.String("error", errorCode),
+				slog.String("description", c.QueryParam("error_description")))
+			return c.String(http.StatusBadRequest, "❌ Authorization was denied. Please try again from Slack.")
+		}
+		server, user, err := linker.Link(c.Request().Context(), c.QueryParam("state"), c.QueryParam("code"))
+		if err != nil {
+			slog.WarnContext(c.Request().Context(), "failed to link account", slog.String("error", err.Error()))
+			return c.String(http.StatusBadRequest, "❌ Failed to link your account. The link may be expired. Please try again from Slack.")
+		}
+		if _, _, err := client.PostMessageContext(
+			c.Request().Context(),
+			user,
+			slack.MsgOptionText(fmt.Sprintf("✅ Your account is linked to `%s`.", server), false)); err != nil {
+			slog.WarnContext(c.Request().Context(), "failed to notify linked account", slog.String("error", err.Error()))
+		}
+		return c.String(http.StatusOK, fmt.Sprintf("✅ Your account is linked to %s. You can close this window and return to Slack.", server))
+	}
+}
+
 // promptFromMention extracts the prompt from the app mention event text.
 func promptFromMention(event *slackevents.AppMentionEvent) string {
 	index := strings.IndexFunc(event.Text, func(r rune) bool {
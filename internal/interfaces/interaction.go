@@ -0,0 +1,123 @@
+package interfaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/slack-go/slack"
+)
+
+// ActionUseCase represents the use-case for handling the actions on the interactive messages.
+type ActionUseCase interface {
+	// HandleAction delivers the action of the user on the interactive message to the pending interaction.
+	//
+	//   - id: The block ID of the actions, which identifies the pending interaction.
+	//   - user: The Slack user ID who clicks the button.
+	//   - action: The action ID of the button.
+	//   - values: The values of the inputs in the message keyed by their block ID.
+	HandleAction(ctx context.Context, id, user, action string, values map[string]string) error
+}
+
+// NewInteractionHandler returns handler for Slack interactions, such as button clicks.
+//
+//   - uc: The use-case for handling the actions on the interactive messages.
+func NewInteractionHandler(uc ActionUseCase) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		callback, ok := interactionFromContext(c)
+		if !ok {
+			return echo.NewHTTPError(http.StatusBadRequest)
+		}
+		if callback.Type != slack.InteractionTypeBlockActions {
+			return c.NoContent(http.StatusOK)
+		}
+		values := stateValues(callback)
+		for _, action := range callback.ActionCallback.BlockActions {
+			slog.Info("action received",
+				slog.String("user_id", callback.User.ID),
+				slog.String("block_id", action.BlockID),
+				slog.String("action_id", action.ActionID))
+			if err := uc.HandleAction(c.Request().Context(), action.BlockID, callback.User.ID, action.ActionID, values); err != nil {
+				slog.Warn("failed to handle action", slog.String("error", err.Error()))
+				respondInteraction(c.Request().Context(), callback, fmt.Sprintf("⚠️ %s", err.Error()))
+			}
+		}
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// stateValues returns the values of the inputs in the message keyed by their block ID.
+// the selected options are joined with commas, and the date time is formatted as unix time.
+func stateValues(callback slack.InteractionCallback) map[string]string {
+	values := make(map[string]string)
+	if callback.BlockActionState == nil {
+		return values
+	}
+	for blockID, actions := range callback.BlockActionState.Values {
+		for _, action := range actions {
+			switch action.Type {
+			case "static_select", "radio_buttons":
+				values[blockID] = action.SelectedOption.Value
+			case "checkboxes", "multi_static_select":
+				selected := make([]string, 0, len(action.SelectedOptions))
+				for _, option := range action.SelectedOptions {
+					selected = append(selected, option.Value)
+				}
+				values[blockID] = strings.Join(selected, ",")
+			case "datepicker":
+				values[blockID] = action.SelectedDate
+			case "timepicker":
+				values[blockID] = action.SelectedTime
+			case "datetimepicker":
+				if action.SelectedDateTime != 0 {
+					values[blockID] = strconv.FormatInt(action.SelectedDateTime, 10)
+				}
+			default:
+				values[blockID] = action.Value
+			}
+		}
+	}
+	return values
+}
+
+// handleInteractionError responds to the interaction with the error, visible only to the user.
+func handleInteractionError(err error, c echo.Context, callback slack.InteractionCallback) {
+	if c.Response().Committed {
+		return
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		slog.WarnContext(c.Request().Context(), "occurred *echo.HTTPError", slog.String("error", httpErr.Error()))
+		switch httpErr.Code {
+		case http.StatusUnauthorized:
+			respondInteraction(c.Request().Context(), callback, "🫵 Unauthorized")
+		case http.StatusForbidden:
+			respondInteraction(c.Request().Context(), callback, "⛔ You are not allowed to perform this operation. Please contact the bot administrator.")
+		default:
+			respondInteraction(c.Request().Context(), callback, "⚠️ Occured unexpected error")
+		}
+	} else {
+		slog.WarnContext(c.Request().Context(), "occurred unexpected error", slog.String("error", err.Error()))
+		respondInteraction(c.Request().Context(), callback, "⚠️ Occured unexpected error")
+	}
+	// slack shows an error on the message unless 200 OK is returned
+	c.NoContent(http.StatusOK)
+}
+
+// respondInteraction sends the message visible only to the user who interacts with the message.
+func respondInteraction(ctx context.Context, callback slack.InteractionCallback, text string) {
+	if callback.ResponseURL == "" {
+		return
+	}
+	if err := slack.PostWebhookContext(ctx, callback.ResponseURL, &slack.WebhookMessage{
+		Text:         text,
+		ResponseType: slack.ResponseTypeEphemeral,
+	}); err != nil {
+		slog.Error("failed to respond to interaction", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,87 @@
+package interfaces
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestStateValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		action slack.BlockAction
+		want   map[string]string
+	}{
+		{
+			name:   "enum",
+			action: slack.BlockAction{Type: slack.ActionType(slack.OptTypeStatic), SelectedOption: slack.OptionBlockObject{Value: "high"}},
+			want:   map[string]string{"field": "high"},
+		},
+		{
+			name:   "enum not selected",
+			action: slack.BlockAction{Type: slack.ActionType(slack.OptTypeStatic)},
+			want:   map[string]string{"field": ""},
+		},
+		{
+			name:   "checked boolean",
+			action: slack.BlockAction{Type: "checkboxes", SelectedOptions: []slack.OptionBlockObject{{Value: "true"}}},
+			want:   map[string]string{"field": "true"},
+		},
+		{
+			name:   "unchecked boolean",
+			action: slack.BlockAction{Type: "checkboxes"},
+			want:   map[string]string{"field": ""},
+		},
+		{
+			name:   "number",
+			action: slack.BlockAction{Type: "number_input", Value: "1.5"},
+			want:   map[string]string{"field": "1.5"},
+		},
+		{
+			name:   "empty number of optional field",
+			action: slack.BlockAction{Type: "number_input"},
+			want:   map[string]string{"field": ""},
+		},
+		{
+			name:   "date",
+			action: slack.BlockAction{Type: "datepicker", SelectedDate: "2026-01-02"},
+			want:   map[string]string{"field": "2026-01-02"},
+		},
+		{
+			name:   "date time",
+			action: slack.BlockAction{Type: "datetimepicker", SelectedDateTime: 1767312000},
+			want:   map[string]string{"field": "1767312000"},
+		},
+		{
+			name:   "date time not selected",
+			action: slack.BlockAction{Type: "datetimepicker"},
+			want:   map[string]string{},
+		},
+		{
+			name:   "text",
+			action: slack.BlockAction{Type: "plain_text_input", Value: "hello"},
+			want:   map[string]string{"field": "hello"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callback := slack.InteractionCallback{
+				BlockActionState: &slack.BlockActionStates{
+					Values: map[string]map[string]slack.BlockAction{
+						"field": {"field": tt.action},
+					},
+				},
+			}
+			if got := stateValues(callback); !maps.Equal(got, tt.want) {
+				t.Errorf("stateValues() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStateValues_NoState(t *testing.T) {
+	if got := stateValues(slack.InteractionCallback{}); len(got) != 0 {
+		t.Errorf("stateValues() = %v, want empty", got)
+	}
+}
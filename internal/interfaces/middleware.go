@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"github.com/goccy/go-json"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"golang.org/x/time/rate"
@@ -65,6 +67,38 @@ func NewParseEvent() echo.MiddlewareFunc {
 	}
 }
 
+// NewParseCommand is a middleware that parses the incoming Slack slash command and sets it in the context.
+func NewParseCommand() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			slog.InfoContext(c.Request().Context(), "Begin parsing slack command")
+			defer slog.InfoContext(c.Request().Context(), "End parsing slack command")
+			command, err := slack.SlashCommandParse(c.Request())
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest)
+			}
+			c.Set("command", command)
+			return next(c)
+		}
+	}
+}
+
+// NewParseInteraction is a middleware that parses the incoming Slack interaction payload and sets it in the context.
+func NewParseInteraction() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			slog.InfoContext(c.Request().Context(), "Begin parsing slack interaction")
+			defer slog.InfoContext(c.Request().Context(), "End parsing slack interaction")
+			var callback slack.InteractionCallback
+			if err := json.Unmarshal([]byte(c.FormValue("payload")), &callback); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest)
+			}
+			c.Set("interaction", callback)
+			return next(c)
+		}
+	}
+}
+
 // NewAuth is a middleware that checks if the user is allowed to access the endpoint.
 func NewAuth(allowedUsers map[string]bool, client *slack.Client) echo.MiddlewareFunc {
 	var userCache sync.Map
@@ -72,13 +106,13 @@ func NewAuth(allowedUsers map[string]bool, client *slack.Client) echo.Middleware
 		return func(c echo.Context) error {
 			slog.InfoContext(c.Request().Context(), "Begin auth middleware")
 			defer slog.InfoContext(c.Request().Context(), "End auth middleware")
-			innerEvent, ok := appMentionEventFromContext(c)
+			userID, ok := requesterFromContext(c)
 			if !ok {
 				return next(c)
 			}
 
 			var user *slack.User
-			if u, ok := userCache.Load(innerEvent.User); ok {
+			if u, ok := userCache.Load(userID); ok {
 				switch u := u.(type) {
 				case *slack.User:
 					user = u
@@ -86,11 +120,11 @@ func NewAuth(allowedUsers map[string]bool, client *slack.Client) echo.Middleware
 			}
 			if user == nil {
 				var err error
-				user, err = client.GetUserInfo(innerEvent.User)
+				user, err = client.GetUserInfo(userID)
 				if err != nil || user == nil {
 					return echo.NewHTTPError(http.StatusUnauthorized)
 				}
-				userCache.Store(innerEvent.User, user)
+				userCache.Store(userID, user)
 			}
 			if user.IsBot || user.IsAppUser {
 				return nil
@@ -118,6 +152,14 @@ func NewErrorHandler(client *slack.Client) echo.HTTPErrorHandler {
 		if err == nil {
 			return
 		}
+		if command, ok := commandFromContext(c); ok {
+			handleCommandError(err, c, command)
+			return
+		}
+		if callback, ok := interactionFromContext(c); ok {
+			handleInteractionError(err, c, callback)
+			return
+		}
 		innerEvent, ok := appMentionEventFromContext(c)
 		if !ok {
 			return
@@ -166,19 +208,73 @@ func NewErrorHandler(client *slack.Client) echo.HTTPErrorHandler {
 	}
 }
 
-// NewRateLimiter is a middleware that limits the rate of requests to the server.
-func NewRateLimiter(limit float64, burst int, expressIn time.Duration) echo.MiddlewareFunc {
+// NewChannelProfile is a middleware that resolves the profile of the channel the bot is mentioned or the slash command is run in,
+// and sets it in the context. the requests from the channels the bot does not respond in are acknowledged and ignored,
+// so that the bot posts nothing there.
+//
+//   - profileOf: Returns the profile of the Slack channel, or false if the bot does not respond in the channel.
+func NewChannelProfile(profileOf func(channel string) (config.Profile, bool)) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			slog.InfoContext(c.Request().Context(), "Begin channel profile middleware")
+			defer slog.InfoContext(c.Request().Context(), "End channel profile middleware")
+			channel, ok := channelFromContext(c)
+			if !ok {
+				return next(c)
+			}
+			profile, ok := profileOf(channel)
+			if !ok {
+				slog.DebugContext(c.Request().Context(), "channel not allowed", slog.String("channel", channel))
+				return c.NoContent(http.StatusOK)
+			}
+			c.Set("profile", profile)
+			return next(c)
+		}
+	}
+}
+
+// NewRateLimiter is a middleware that limits the rate of requests of each user by the rate limit of the channel profile.
+// the user shares the quota among the channels with the same rate limit.
+func NewRateLimiter() echo.MiddlewareFunc {
+	// limiters are the rate limiters keyed by config.RateLimitConfig
+	var limiters sync.Map
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			slog.InfoContext(c.Request().Context(), "Begin rate limiter")
+			defer slog.InfoContext(c.Request().Context(), "End rate limiter")
+			profile, ok := profileFromContext(c)
+			if !ok || !profile.RateLimit.Enable {
+				return next(c)
+			}
+			limiter, ok := limiters.Load(profile.RateLimit)
+			if !ok {
+				limiter, _ = limiters.LoadOrStore(profile.RateLimit, newRateLimiter(
+					profile.RateLimit.Limit, profile.RateLimit.Burst, time.Duration(profile.RateLimit.ExpressIn)*time.Second))
+			}
+			return limiter.(echo.MiddlewareFunc)(next)(c)
+		}
+	}
+}
+
+// newRateLimiter returns the rate limiter of the users with the rate limit.
+func newRateLimiter(limit float64, burst int, expressIn time.Duration) echo.MiddlewareFunc {
 	if limit <= 0 {
 		limit = 1
 	}
 	config := middleware.RateLimiterConfig{
 		Skipper: func(c echo.Context) bool {
-			event := c.Get("event").(slackevents.EventsAPIEvent)
-			if event.Type == "" {
-				return true
-			}
-			if event.Type == slackevents.URLVerification {
-				return true
+			// slash commands have no event
+			if event, ok := c.Get("event").(slackevents.EventsAPIEvent); ok {
+				if event.Type == "" {
+					return true
+				}
+				if event.Type == slackevents.URLVerification {
+					return true
+				}
+				// only the mentions start sessions, and the other events, such as reactions, have no user in the context
+				if _, ok := appMentionEventFromContext(c); !ok {
+					return true
+				}
 			}
 			if c.Request().Header.Get("X-Slack-Retry-Num") != "" {
 				return true
@@ -202,14 +298,7 @@ func NewRateLimiter(limit float64, burst int, expressIn time.Duration) echo.Midd
 			return echo.NewHTTPError(http.StatusTooManyRequests)
 		},
 	}
-	f := middleware.RateLimiterWithConfig(config)
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			slog.InfoContext(c.Request().Context(), "Begin rate limiter")
-			defer slog.InfoContext(c.Request().Context(), "End rate limiter")
-			return f(next)(c)
-		}
-	}
+	return middleware.RateLimiterWithConfig(config)
 }
 
 // NewSessionMiddleware is a middleware that checks if the session already exists.
@@ -252,6 +341,51 @@ func userFromContext(c echo.Context) (*slack.User, error) {
 	return nil, echo.NewHTTPError(http.StatusInternalServerError)
 }
 
+// commandFromContext retrieves the slash command from the context.
+func commandFromContext(c echo.Context) (slack.SlashCommand, bool) {
+	command, ok := c.Get("command").(slack.SlashCommand)
+	return command, ok
+}
+
+// interactionFromContext retrieves the interaction from the context.
+func interactionFromContext(c echo.Context) (slack.InteractionCallback, bool) {
+	callback, ok := c.Get("interaction").(slack.InteractionCallback)
+	return callback, ok
+}
+
+// requesterFromContext retrieves the ID of the user who mentions the bot, runs the slash command or interacts with the message.
+func requesterFromContext(c echo.Context) (string, bool) {
+	if command, ok := commandFromContext(c); ok {
+		return command.UserID, true
+	}
+	if callback, ok := interactionFromContext(c); ok {
+		return callback.User.ID, true
+	}
+	innerEvent, ok := appMentionEventFromContext(c)
+	if !ok {
+		return "", false
+	}
+	return innerEvent.User, true
+}
+
+// profileFromContext retrieves the profile of the channel from the context.
+func profileFromContext(c echo.Context) (config.Profile, bool) {
+	profile, ok := c.Get("profile").(config.Profile)
+	return profile, ok
+}
+
+// channelFromContext retrieves the ID of the channel where the bot is mentioned or the slash command is run.
+func channelFromContext(c echo.Context) (string, bool) {
+	if command, ok := commandFromContext(c); ok {
+		return command.ChannelID, true
+	}
+	innerEvent, ok := appMentionEventFromContext(c)
+	if !ok {
+		return "", false
+	}
+	return innerEvent.Channel, true
+}
+
 // appMentionEventFromContext retrieves the AppMentionEvent from the context.
 func appMentionEventFromContext(c echo.Context) (*slackevents.AppMentionEvent, bool) {
 	event := c.Get("event")
@@ -0,0 +1,195 @@
+// Package llmprovider creates the LLM providers of mcphost, which also generate the messages for the sampling requests.
+// the providers of mcphost take neither the system prompt nor the maximum number of tokens of each request,
+// so the messages for the sampling requests are generated with the API of the provider.
+package llmprovider
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/mark3labs/mcphost/pkg/history"
+	"github.com/mark3labs/mcphost/pkg/llm"
+	"github.com/mark3labs/mcphost/pkg/llm/anthropic"
+	"github.com/mark3labs/mcphost/pkg/llm/google"
+	"github.com/mark3labs/mcphost/pkg/llm/openai"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+)
+
+// errModelRequired is returned when the messages for the sampling requests are generated without the model name.
+var errModelRequired = errors.New("llmModelName is required for sampling")
+
+// New creates an LLM provider from the given settings.
+// the provider also implements Sample.
+func New(ctx context.Context, cfg config.LLMConfig) (llm.Provider, error) {
+	slog.DebugContext(ctx, "llmprovider.New", slog.String("provider", cfg.ProviderName), slog.String("baseURL", cfg.BaseURL), slog.String("modelName", cfg.ModelName))
+	switch cfg.ProviderName {
+	case config.LLMProviderAnthropic:
+		return &anthropicProvider{
+			Provider: anthropic.NewProvider(cfg.APIKey, cfg.BaseURL, cfg.ModelName, cfg.SystemPrompt),
+			client:   anthropic.NewClient(cfg.APIKey, cfg.BaseURL),
+			model:    cfg.ModelName,
+		}, nil
+	case config.LLMProviderOpenAI:
+		return &openaiProvider{
+			Provider: openai.NewProvider(cfg.APIKey, cfg.BaseURL, cfg.ModelName, cfg.SystemPrompt),
+			client:   openai.NewClient(cfg.APIKey, cfg.BaseURL),
+			model:    cfg.ModelName,
+		}, nil
+	case config.LLMProviderGoogle:
+		if cfg.ModelName == "" {
+			return nil, errors.New("llmModelName is required for google")
+		}
+		provider, err := google.NewProvider(ctx, cfg.APIKey, cfg.ModelName, cfg.SystemPrompt)
+		if err != nil {
+			return nil, err
+		}
+		client, err := genai.NewClient(ctx, option.WithAPIKey(cfg.APIKey))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create google client")
+		}
+		return &googleProvider{
+			Provider: provider,
+			client:   client,
+			model:    cfg.ModelName,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported LLM provider: %s", cfg.ProviderName)
+	}
+}
+
+// anthropicProvider is the anthropic provider of mcphost, which also generates the messages for the sampling requests.
+type anthropicProvider struct {
+	*anthropic.Provider
+	client *anthropic.Client
+	model  string
+}
+
+// Sample generates the message following the messages.
+//
+//   - systemPrompt: The system prompt of the request, which replaces the one of the settings.
+//   - maxTokens: The maximum number of tokens to generate.
+func (p *anthropicProvider) Sample(ctx context.Context, systemPrompt string, messages []history.HistoryMessage, maxTokens int) (string, error) {
+	if p.model == "" {
+		return "", errModelRequired
+	}
+	params := make([]anthropic.MessageParam, 0, len(messages))
+	for _, message := range messages {
+		params = append(params, anthropic.MessageParam{
+			Role:    message.Role,
+			Content: []anthropic.ContentBlock{{Type: "text", Text: textOf(message)}},
+		})
+	}
+	resp, err := p.client.CreateMessage(ctx, anthropic.CreateRequest{
+		Model:     p.model,
+		Messages:  params,
+		MaxTokens: maxTokens,
+		System:    systemPrompt,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create message")
+	}
+	var texts []string
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// openaiProvider is the openai provider of mcphost, which also generates the messages for the sampling requests.
+type openaiProvider struct {
+	*openai.Provider
+	client *openai.Client
+	model  string
+}
+
+// Sample generates the message following the messages.
+//
+//   - systemPrompt: The system prompt of the request, which replaces the one of the settings.
+//   - maxTokens: The maximum number of tokens to generate.
+func (p *openaiProvider) Sample(ctx context.Context, systemPrompt string, messages []history.HistoryMessage, maxTokens int) (string, error) {
+	if p.model == "" {
+		return "", errModelRequired
+	}
+	params := make([]openai.MessageParam, 0, len(messages)+1)
+	if systemPrompt != "" {
+		params = append(params, openai.MessageParam{Role: "system", Content: &systemPrompt})
+	}
+	for _, message := range messages {
+		text := textOf(message)
+		params = append(params, openai.MessageParam{Role: message.Role, Content: &text})
+	}
+	resp, err := p.client.CreateChatCompletion(ctx, openai.CreateRequest{
+		Model:     p.model,
+		Messages:  params,
+		MaxTokens: maxTokens,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create chat completion")
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == nil {
+		return "", errors.New("no choices in response")
+	}
+	return *resp.Choices[0].Message.Content, nil
+}
+
+// googleProvider is the google provider of mcphost, which also generates the messages for the sampling requests.
+type googleProvider struct {
+	*google.Provider
+	client *genai.Client
+	model  string
+}
+
+// Sample generates the message following the messages.
+//
+//   - systemPrompt: The system prompt of the request, which replaces the one of the settings.
+//   - maxTokens: The maximum number of tokens to generate.
+func (p *googleProvider) Sample(ctx context.Context, systemPrompt string, messages []history.HistoryMessage, maxTokens int) (string, error) {
+	if len(messages) == 0 {
+		return "", errors.New("no messages to sample")
+	}
+	model := p.client.GenerativeModel(p.model)
+	if systemPrompt != "" {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(systemPrompt))
+	}
+	model.SetMaxOutputTokens(int32(maxTokens))
+	chat := model.StartChat()
+	for _, message := range messages[:len(messages)-1] {
+		role := "user"
+		if message.Role == "assistant" {
+			role = "model"
+		}
+		chat.History = append(chat.History, &genai.Content{Role: role, Parts: []genai.Part{genai.Text(textOf(message))}})
+	}
+	resp, err := chat.SendMessage(ctx, genai.Text(textOf(messages[len(messages)-1])))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate content")
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return "", errors.New("no candidates in response")
+	}
+	var texts []string
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if text, ok := part.(genai.Text); ok {
+			texts = append(texts, string(text))
+		}
+	}
+	return strings.Join(texts, ""), nil
+}
+
+// textOf returns the text of the message.
+func textOf(message history.HistoryMessage) string {
+	var texts []string
+	for _, block := range message.Content {
+		if block.Type == "text" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
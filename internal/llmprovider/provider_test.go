@@ -0,0 +1,167 @@
+package llmprovider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/google/generative-ai-go/genai"
+	"github.com/mark3labs/mcphost/pkg/history"
+	"github.com/mark3labs/mcphost/pkg/llm/anthropic"
+	"github.com/mark3labs/mcphost/pkg/llm/openai"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"google.golang.org/api/option"
+)
+
+// sampler is the provider generating the messages for the sampling requests.
+type sampler interface {
+	Sample(ctx context.Context, systemPrompt string, messages []history.HistoryMessage, maxTokens int) (string, error)
+}
+
+func TestSample(t *testing.T) {
+	messages := []history.HistoryMessage{
+		{Role: "user", Content: []history.ContentBlock{{Type: "text", Text: "hello"}}},
+		{Role: "assistant", Content: []history.ContentBlock{{Type: "text", Text: "hi"}}},
+		{Role: "user", Content: []history.ContentBlock{{Type: "text", Text: "summarize"}}},
+	}
+	tests := []struct {
+		name     string
+		path     string
+		response string
+		provider func(url string) sampler
+		// want is the request body expected by the API.
+		want string
+	}{
+		{
+			name:     "anthropic",
+			path:     "/v1/messages",
+			response: `{"role":"assistant","content":[{"type":"text","text":"summary"}]}`,
+			provider: func(url string) sampler {
+				return &anthropicProvider{client: anthropic.NewClient("key", url), model: "model"}
+			},
+			want: `{"model":"model","messages":[` +
+				`{"role":"user","content":[{"type":"text","text":"hello"}]},` +
+				`{"role":"assistant","content":[{"type":"text","text":"hi"}]},` +
+				`{"role":"user","content":[{"type":"text","text":"summarize"}]}],` +
+				`"max_tokens":100,"system":"be brief"}`,
+		},
+		{
+			name:     "openai",
+			path:     "/chat/completions",
+			response: `{"choices":[{"message":{"role":"assistant","content":"summary"}}]}`,
+			provider: func(url string) sampler {
+				return &openaiProvider{client: openai.NewClient("key", url), model: "model"}
+			},
+			want: `{"model":"model","messages":[` +
+				`{"role":"system","content":"be brief"},` +
+				`{"role":"user","content":"hello"},` +
+				`{"role":"assistant","content":"hi"},` +
+				`{"role":"user","content":"summarize"}],` +
+				`"max_tokens":100}`,
+		},
+		{
+			name: "google",
+			// the SDK always streams the content
+			path:     "/v1beta/models/model:streamGenerateContent",
+			response: `[{"candidates":[{"content":{"role":"model","parts":[{"text":"sum"}]}}]},{"candidates":[{"content":{"role":"model","parts":[{"text":"mary"}]}}]}]`,
+			provider: func(url string) sampler {
+				return &googleProvider{client: newGoogleClient(t, url), model: "model"}
+			},
+			want: `{"model":"models/model","contents":[` +
+				`{"role":"user","parts":[{"text":"hello"}]},` +
+				`{"role":"model","parts":[{"text":"hi"}]},` +
+				`{"role":"user","parts":[{"text":"summarize"}]}],` +
+				`"systemInstruction":{"role":"user","parts":[{"text":"be brief"}]},` +
+				`"generationConfig":{"candidateCount":1,"maxOutputTokens":100}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []byte
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.path {
+					t.Errorf("path = %q, want %q", r.URL.Path, tt.path)
+				}
+				got, _ = io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, tt.response)
+			}))
+			defer ts.Close()
+
+			text, err := tt.provider(ts.URL).Sample(context.Background(), "be brief", messages, 100)
+			if err != nil {
+				t.Fatalf("Sample() error = %v", err)
+			}
+			if text != "summary" {
+				t.Errorf("Sample() = %q, want %q", text, "summary")
+			}
+			if !jsonEqual(t, got, []byte(tt.want)) {
+				t.Errorf("request body = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSample_Error(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":{"code":400,"status":"INVALID_ARGUMENT","message":"bad request"}}`)
+	}))
+	defer ts.Close()
+
+	messages := []history.HistoryMessage{{Role: "user", Content: []history.ContentBlock{{Type: "text", Text: "hello"}}}}
+	tests := []struct {
+		name     string
+		provider sampler
+		messages []history.HistoryMessage
+	}{
+		{name: "error response", provider: &googleProvider{client: newGoogleClient(t, ts.URL), model: "model"}, messages: messages},
+		{name: "no messages", provider: &googleProvider{client: newGoogleClient(t, ts.URL), model: "model"}},
+		{name: "anthropic without model", provider: &anthropicProvider{client: anthropic.NewClient("key", ts.URL)}, messages: messages},
+		{name: "openai without model", provider: &openaiProvider{client: openai.NewClient("key", ts.URL)}, messages: messages},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.provider.Sample(context.Background(), "", tt.messages, 100); err == nil {
+				t.Error("Sample() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestNew_GoogleWithoutModel(t *testing.T) {
+	_, err := New(context.Background(), config.LLMConfig{ProviderName: config.LLMProviderGoogle, APIKey: "key"})
+	if err == nil {
+		t.Error("New() error = nil, want error for empty model")
+	}
+}
+
+// newGoogleClient returns the client of the Gemini API sending the requests to url.
+func newGoogleClient(t *testing.T, url string) *genai.Client {
+	t.Helper()
+	client, err := genai.NewClient(context.Background(), option.WithAPIKey("key"), option.WithEndpoint(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// jsonEqual reports whether the JSON documents are equal regardless of the formatting.
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var va, vb any
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("failed to unmarshal %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("failed to unmarshal %s: %v", b, err)
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return string(ja) == string(jb)
+}
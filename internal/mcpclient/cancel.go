@@ -0,0 +1,83 @@
+package mcpclient
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// cancelNotificationTimeout is the timeout to notify the server of the cancelled request.
+const cancelNotificationTimeout = 5 * time.Second
+
+// cancellingTransport is transport.Interface that notifies the server when a request is cancelled,
+// so that the server can stop processing it. the client does not notify the server by itself.
+//
+// it implements the optional interfaces of the transports checked by the client,
+// and they do nothing if the underlying transport does not implement them.
+type cancellingTransport struct {
+	transport.Interface
+}
+
+var (
+	_ transport.BidirectionalInterface = (*cancellingTransport)(nil)
+	_ transport.HTTPConnection         = (*cancellingTransport)(nil)
+)
+
+// withCancellation returns the transport notifying the server of the cancelled requests.
+func withCancellation(t transport.Interface) *cancellingTransport {
+	return &cancellingTransport{Interface: t}
+}
+
+func (t *cancellingTransport) SendRequest(ctx context.Context, request transport.JSONRPCRequest) (*transport.JSONRPCResponse, error) {
+	response, err := t.Interface.SendRequest(ctx, request)
+	// the client must not cancel the initialize request
+	if err != nil && ctx.Err() != nil && request.Method != string(mcp.MethodInitialize) {
+		t.notifyCancelled(ctx, request.ID)
+	}
+	return response, err
+}
+
+// notifyCancelled sends `notifications/cancelled` for the request with the cause of ctx as the reason.
+func (t *cancellingTransport) notifyCancelled(ctx context.Context, id mcp.RequestId) {
+	reason := context.Cause(ctx).Error()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cancelNotificationTimeout)
+	defer cancel()
+	notification := mcp.JSONRPCNotification{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		Notification: mcp.Notification{
+			Method: methodNotificationCancelled,
+			Params: mcp.NotificationParams{
+				AdditionalFields: map[string]any{
+					"requestId": id,
+					"reason":    reason,
+				},
+			},
+		},
+	}
+	if err := t.Interface.SendNotification(ctx, notification); err != nil {
+		slog.Warn("failed to notify cancelled request", slog.String("id", id.String()), slog.String("error", err.Error()))
+		return
+	}
+	slog.Info("notified cancelled request", slog.String("id", id.String()), slog.String("reason", reason))
+}
+
+func (t *cancellingTransport) SetRequestHandler(handler transport.RequestHandler) {
+	if t, ok := t.Interface.(transport.BidirectionalInterface); ok {
+		t.SetRequestHandler(handler)
+	}
+}
+
+func (t *cancellingTransport) SetProtocolVersion(version string) {
+	if t, ok := t.Interface.(transport.HTTPConnection); ok {
+		t.SetProtocolVersion(version)
+	}
+}
+
+func (t *cancellingTransport) SetConnectionLostHandler(handler func(error)) {
+	if t, ok := t.Interface.(interface{ SetConnectionLostHandler(func(error)) }); ok {
+		t.SetConnectionLostHandler(handler)
+	}
+}
@@ -0,0 +1,282 @@
+package mcpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcphost/pkg/llm"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/pkg/errors"
+)
+
+// initializeTimeout is the timeout for initializing an MCP client.
+const initializeTimeout = 1 * time.Minute
+
+// New creates and initializes an MCP client from the given configuration.
+//
+//   - options: The options of the client, such as the handlers of the requests from the server.
+func New(rootCtx context.Context, name string, server config.MCPServerConfig, options ...client.ClientOption) (client.MCPClient, error) {
+	return newClient(rootCtx, name, server, nil, options...)
+}
+
+// newClient creates and initializes an MCP client from the given configuration.
+// if tokens is nil, the access tokens are obtained as configured in server.OAuth.
+func newClient(rootCtx context.Context, name string, server config.MCPServerConfig, tokens *tokenSource, options ...client.ClientOption) (client.MCPClient, error) {
+	slog.InfoContext(rootCtx, "create mcp client", slog.String("name", name))
+	var (
+		c   client.MCPClient
+		err error
+	)
+	switch server.Transport() {
+	case config.TransportSSE:
+		c, err = newSSEClient(rootCtx, name, server, tokens, options)
+	case config.TransportStreamableHTTP:
+		c, err = newStreamableHTTPClient(rootCtx, name, server, tokens, options)
+	default:
+		env := make([]string, 0, len(server.Env))
+		for k, v := range server.Env {
+			env = append(env, fmt.Sprintf("%s=%v", k, v))
+		}
+		c, err = newStdioClient(rootCtx, server, env, options)
+	}
+	if err != nil {
+		slog.ErrorContext(
+			rootCtx,
+			`failed to create mcp client`,
+			slog.String("name", name),
+			slog.String("transport", server.Transport()),
+			slog.String("command", server.Command),
+			slog.Any("args", server.Args),
+			slog.String("url", server.URL),
+			slog.String("error", err.Error()))
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to create mcp client: %s", name))
+	}
+	slog.InfoContext(rootCtx, "created mcp client",
+		slog.String("name", name),
+		slog.String("transport", server.Transport()),
+		slog.String("command", server.Command),
+		slog.Any("args", server.Args),
+		slog.String("cwd", server.Cwd),
+		slog.String("url", server.URL))
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{
+		Name:    "mcphost",
+		Version: "0.1.0",
+	}
+	initRequest.Params.Capabilities = mcp.ClientCapabilities{}
+
+	slog.InfoContext(rootCtx, "initialize mcp client", slog.String("name", name))
+	ctx, cancel := context.WithTimeout(rootCtx, initializeTimeout)
+	defer cancel()
+	result, err := c.Initialize(ctx, initRequest)
+	if err != nil {
+		c.Close()
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to initialize mcp client: %s", name))
+	}
+	// the servers send only errors by default. the log messages are shown to the users during the tool calls.
+	if result.Capabilities.Logging != nil {
+		request := mcp.SetLevelRequest{}
+		request.Params.Level = mcp.LoggingLevelInfo
+		if err := c.SetLevel(ctx, request); err != nil {
+			slog.WarnContext(rootCtx, "failed to set log level", slog.String("name", name), slog.String("error", err.Error()))
+		}
+	}
+	slog.InfoContext(rootCtx, "mcp client initialized",
+		slog.String("name", name),
+		slog.String("transport", server.Transport()),
+		slog.String("sessionId", sessionID(c)))
+	return c, nil
+}
+
+// newStdioClient spawns the stdio server and returns an MCP client connected to it.
+func newStdioClient(rootCtx context.Context, server config.MCPServerConfig, env []string, options []client.ClientOption) (*client.Client, error) {
+	c := client.NewClient(
+		withCancellation(transport.NewStdioWithOptions(
+			server.Command,
+			env,
+			server.Args,
+			transport.WithCommandFunc(commandFunc(server.Cwd, server.InheritsEnv())))),
+		options...)
+	// the process lives as long as the context passed to Start, so it must not be cancelled with rootCtx.
+	if err := c.Start(context.WithoutCancel(rootCtx)); err != nil {
+		c.Close()
+		return nil, errors.Wrap(err, "failed to start stdio transport")
+	}
+	return c, nil
+}
+
+// newSSEClient creates and starts an MCP client connected to the SSE server.
+func newSSEClient(rootCtx context.Context, name string, server config.MCPServerConfig, tokens *tokenSource, options []client.ClientOption) (*client.Client, error) {
+	httpClient, err := newHTTPClient(name, server, tokens)
+	if err != nil {
+		return nil, err
+	}
+	t, err := transport.NewSSE(
+		server.URL,
+		transport.WithHeaders(headers(server)),
+		transport.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+	c := client.NewClient(withCancellation(t), options...)
+	// the SSE stream lives as long as the context passed to Start, so it must not be cancelled with rootCtx.
+	if err := c.Start(context.WithoutCancel(rootCtx)); err != nil {
+		c.Close()
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to connect to %s", server.URL))
+	}
+	return c, nil
+}
+
+// newStreamableHTTPClient creates and starts an MCP client connected to the streamable HTTP server.
+func newStreamableHTTPClient(rootCtx context.Context, name string, server config.MCPServerConfig, tokens *tokenSource, options []client.ClientOption) (*client.Client, error) {
+	httpClient, err := newHTTPClient(name, server, tokens)
+	if err != nil {
+		return nil, err
+	}
+	transportOptions := []transport.StreamableHTTPCOption{
+		transport.WithHTTPHeaders(headers(server)),
+	}
+	if server.Listen {
+		httpClient.Transport = newResumableTransport(httpClient.Transport)
+		transportOptions = append(transportOptions, transport.WithContinuousListening())
+	}
+	transportOptions = append(transportOptions, transport.WithHTTPBasicClient(httpClient))
+	t, err := transport.NewStreamableHTTP(server.URL, transportOptions...)
+	if err != nil {
+		return nil, err
+	}
+	c := client.NewClient(withCancellation(t), options...)
+	// the GET stream lives as long as the context passed to Start, so it must not be cancelled with rootCtx.
+	if err := c.Start(context.WithoutCancel(rootCtx)); err != nil {
+		c.Close()
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to connect to %s", server.URL))
+	}
+	return c, nil
+}
+
+// sessionID returns the session ID assigned by the remote server, or empty string if none.
+func sessionID(c client.MCPClient) string {
+	if c, ok := c.(*client.Client); ok {
+		return c.GetSessionId()
+	}
+	return ""
+}
+
+// headers returns the HTTP headers sent to the remote server.
+func headers(server config.MCPServerConfig) map[string]string {
+	headers := make(map[string]string, len(server.Headers)+1)
+	for k, v := range server.Headers {
+		headers[k] = v
+	}
+	if server.BearerToken != "" {
+		headers["Authorization"] = "Bearer " + server.BearerToken
+	}
+	return headers
+}
+
+// newHTTPClient returns *http.Client to connect to the remote server.
+// the requests are authorized with OAuth access token from tokens, or as configured in server.OAuth if tokens is nil.
+func newHTTPClient(name string, server config.MCPServerConfig, tokens *tokenSource) (*http.Client, error) {
+	t, err := newTLSTransport(server.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tokens == nil && server.OAuth != nil {
+		tokens = newTokenSource(&http.Client{Transport: t}, name, server.URL, *server.OAuth, nil)
+	}
+	if tokens == nil {
+		return &http.Client{Transport: t}, nil
+	}
+	return &http.Client{Transport: newOAuthTransport(t, tokens)}, nil
+}
+
+// newTLSTransport returns *http.Transport configured with the given TLS configuration.
+func newTLSTransport(cfg config.TLSConfig) (*http.Transport, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to read CA file: %s", cfg.CAFile))
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file: %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig
+	return t, nil
+}
+
+// commandFunc returns transport.CommandFunc that runs the stdio server in cwd.
+// if inheritEnv is false, the server receives only the configured environment variables.
+func commandFunc(cwd string, inheritEnv bool) transport.CommandFunc {
+	return func(ctx context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
+		cmd := exec.CommandContext(ctx, command, args...)
+		cmd.Dir = cwd
+		if inheritEnv {
+			cmd.Env = append(os.Environ(), env...)
+		} else {
+			// nil Env inherits the environment of the host process
+			cmd.Env = append([]string{}, env...)
+		}
+		return cmd, nil
+	}
+}
+
+// ListTools converts mcp.Tool to llm.Tool. the tools are named as the server names them, not as sent to the LLM.
+// the names of the tools annotated as destructive by the server are returned as destructive.
+func ListTools(ctx context.Context, mcpClient client.MCPClient, mcpServerName string) (llmTools []llm.Tool, destructive map[string]bool, err error) {
+	toolsResult, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, fmt.Sprintf("failed to list tools: %s", mcpServerName))
+	}
+	llmTools = make([]llm.Tool, 0, len(toolsResult.Tools))
+	destructive = make(map[string]bool)
+	for _, tool := range toolsResult.Tools {
+		if isDestructive(tool.Annotations) {
+			destructive[tool.Name] = true
+		}
+		llmTools = append(llmTools, llm.Tool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: llm.Schema{
+				Type:       tool.InputSchema.Type,
+				Properties: tool.InputSchema.Properties,
+				Required:   tool.InputSchema.Required,
+			},
+		})
+	}
+	return llmTools, destructive, nil
+}
+
+// isDestructive reports whether the tool may perform destructive updates.
+// as the spec, the hints default to not read-only and destructive if the server omits them.
+func isDestructive(annotations mcp.ToolAnnotation) bool {
+	if annotations.ReadOnlyHint != nil && *annotations.ReadOnlyHint {
+		return false
+	}
+	return annotations.DestructiveHint == nil || *annotations.DestructiveHint
+}
@@ -0,0 +1,111 @@
+package mcpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+)
+
+// recordedRequest is the request received by the test server.
+type recordedRequest struct {
+	sessionID string
+	header    string
+}
+
+// newStreamableHTTPTestServer starts the in-process streamable HTTP server with the echo tool,
+// and returns the requests it receives.
+func newStreamableHTTPTestServer(t *testing.T) (*httptest.Server, func() []recordedRequest) {
+	t.Helper()
+	s := mcpserver.NewMCPServer("test", "1.0.0")
+	s.AddTool(
+		mcp.NewTool("echo", mcp.WithString("text")),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("echo:" + request.GetString("text", "")), nil
+		})
+	handler := mcpserver.NewStreamableHTTPServer(s)
+
+	var (
+		mu       sync.Mutex
+		requests []recordedRequest
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, recordedRequest{
+			sessionID: r.Header.Get(mcpserver.HeaderKeySessionID),
+			header:    r.Header.Get("X-Test"),
+		})
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, func() []recordedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recordedRequest{}, requests...)
+	}
+}
+
+func TestNewClient_StreamableHTTP(t *testing.T) {
+	ts, requests := newStreamableHTTPTestServer(t)
+	ctx := context.Background()
+
+	c, err := newClient(ctx, "test", config.MCPServerConfig{
+		Type:    config.TransportStreamableHTTP,
+		URL:     ts.URL,
+		Headers: map[string]string{"X-Test": "value"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	id := sessionID(c)
+	if id == "" {
+		t.Fatal("sessionID() is empty after initialization")
+	}
+
+	tools, _, err := ListTools(ctx, c, "test")
+	if err != nil {
+		t.Fatalf("ListTools() error = %v", err)
+	}
+	if len(tools) != 1 || tools[0].Name != "echo" {
+		t.Fatalf("ListTools() = %+v, want the echo tool", tools)
+	}
+
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "echo"
+	request.Params.Arguments = map[string]any{"text": "hello"}
+	result, err := c.CallTool(ctx, request)
+	if err != nil {
+		t.Fatalf("CallTool() error = %v", err)
+	}
+	if len(result.Content) != 1 {
+		t.Fatalf("CallTool() content = %+v, want one content", result.Content)
+	}
+	if text, ok := result.Content[0].(mcp.TextContent); !ok || text.Text != "echo:hello" {
+		t.Errorf("CallTool() content = %+v, want echo:hello", result.Content[0])
+	}
+
+	got := requests()
+	if len(got) < 3 {
+		t.Fatalf("server received %d requests, want initialize, tools/list and tools/call at least", len(got))
+	}
+	for i, r := range got {
+		if r.header != "value" {
+			t.Errorf("request %d X-Test header = %q, want %q", i, r.header, "value")
+		}
+		// the session ID is assigned in the response to initialize
+		if i == 0 {
+			continue
+		}
+		if r.sessionID != id {
+			t.Errorf("request %d session ID = %q, want %q", i, r.sessionID, id)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package mcpclient
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pkg/errors"
+)
+
+// Elicitor asks the user for the input requested by the servers.
+type Elicitor interface {
+	// Elicit asks the user for the input of the request from the server.
+	//
+	//   - c: The client connected to the server, which the request is attributed to.
+	//   - server: The name of the server.
+	Elicit(ctx context.Context, c client.MCPClient, server string, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error)
+}
+
+// elicitationHandler is client.ElicitationHandler that forwards the elicitation requests from a server to the Elicitor.
+type elicitationHandler struct {
+	server   string
+	handlers *handlers
+	// client returns the client the requests are attributed to.
+	client func() client.MCPClient
+}
+
+var _ client.ElicitationHandler = (*elicitationHandler)(nil)
+
+func (h *elicitationHandler) Elicit(ctx context.Context, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	slog.InfoContext(ctx, "elicitation requested", slog.String("server", h.server), slog.String("mode", request.Params.Mode))
+	// only form mode is advertised in the capability
+	if mode := request.Params.Mode; mode != "" && mode != mcp.ElicitationModeForm {
+		return nil, errors.New(fmt.Sprintf("elicitation mode is not supported: %s", mode))
+	}
+	elicitor := h.handlers.getElicitor()
+	if elicitor == nil {
+		return nil, errors.New("elicitation is not available")
+	}
+	return elicitor.Elicit(ctx, h.client(), h.server, request)
+}
@@ -0,0 +1,69 @@
+package mcpclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// fakeElicitor is Elicitor that accepts the requests with the content.
+type fakeElicitor struct {
+	server  string
+	content any
+}
+
+func (e *fakeElicitor) Elicit(ctx context.Context, c client.MCPClient, server string, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	e.server = server
+	return &mcp.ElicitationResult{ElicitationResponse: mcp.ElicitationResponse{
+		Action:  mcp.ElicitationResponseActionAccept,
+		Content: e.content,
+	}}, nil
+}
+
+func TestElicitationHandler_Elicit(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		elicitor Elicitor
+		wantErr  bool
+	}{
+		{name: "form", mode: mcp.ElicitationModeForm, elicitor: &fakeElicitor{content: map[string]any{"ok": true}}},
+		{name: "default mode", mode: "", elicitor: &fakeElicitor{content: map[string]any{"ok": true}}},
+		{name: "unsupported mode", mode: "url", elicitor: &fakeElicitor{}, wantErr: true},
+		{name: "no elicitor", mode: mcp.ElicitationModeForm, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &elicitationHandler{
+				server:   "test",
+				handlers: &handlers{},
+				client:   func() client.MCPClient { return nil },
+			}
+			if tt.elicitor != nil {
+				h.handlers.setElicitor(tt.elicitor)
+			}
+			request := mcp.ElicitationRequest{}
+			request.Params.Mode = tt.mode
+			request.Params.RequestedSchema = map[string]any{"type": "object"}
+
+			result, err := h.Elicit(context.Background(), request)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Elicit() = %+v, want error", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Elicit() error = %v", err)
+			}
+			if result.Action != mcp.ElicitationResponseActionAccept {
+				t.Errorf("Elicit() action = %q, want %q", result.Action, mcp.ElicitationResponseActionAccept)
+			}
+			if server := tt.elicitor.(*fakeElicitor).server; server != "test" {
+				t.Errorf("Elicit() forwarded to server %q, want %q", server, "test")
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package mcpclient
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/goccy/go-json"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+)
+
+// the methods of the notifications, which are not defined in mcp package.
+const (
+	methodNotificationProgress  = "notifications/progress"
+	methodNotificationMessage   = "notifications/message"
+	methodNotificationCancelled = "notifications/cancelled"
+)
+
+// handlers holds the handlers of the requests from the servers.
+// they are set after the pool is created, as they depend on the clients of the pool.
+type handlers struct {
+	mu       sync.RWMutex
+	sampler  Sampler
+	elicitor Elicitor
+	observer Observer
+	resolver ChannelResolver
+}
+
+// Observer observes the notifications from the servers.
+type Observer interface {
+	// OnProgress is called when the server notifies the progress of the request with the progress token.
+	//
+	//   - c: The client connected to the server.
+	//   - server: The name of the server.
+	OnProgress(c client.MCPClient, server string, params mcp.ProgressNotificationParams)
+	// OnLog is called when the server sends the log message.
+	//
+	//   - c: The client connected to the server.
+	//   - server: The name of the server.
+	OnLog(c client.MCPClient, server string, params mcp.LoggingMessageNotificationParams)
+}
+
+func (h *handlers) setSampler(sampler Sampler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sampler = sampler
+}
+
+func (h *handlers) getSampler() Sampler {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.sampler
+}
+
+func (h *handlers) setElicitor(elicitor Elicitor) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.elicitor = elicitor
+}
+
+func (h *handlers) getElicitor() Elicitor {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.elicitor
+}
+
+func (h *handlers) setObserver(observer Observer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.observer = observer
+}
+
+func (h *handlers) getObserver() Observer {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.observer
+}
+
+func (h *handlers) setChannelResolver(resolver ChannelResolver) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.resolver = resolver
+}
+
+func (h *handlers) getChannelResolver() ChannelResolver {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.resolver
+}
+
+// observe forwards the progress and log notifications from the server connected with c to the Observer.
+// the handler is called on the goroutine reading the responses, so the Observer must not block it.
+func observe(name string, handlers *handlers, c client.MCPClient) func(notification mcp.JSONRPCNotification) {
+	return func(notification mcp.JSONRPCNotification) {
+		observer := handlers.getObserver()
+		if observer == nil {
+			return
+		}
+		switch notification.Method {
+		case methodNotificationProgress:
+			var params mcp.ProgressNotificationParams
+			if err := remarshal(notification.Params, &params); err != nil {
+				slog.Warn("invalid progress notification", slog.String("server", name), slog.String("error", err.Error()))
+				return
+			}
+			observer.OnProgress(c, name, params)
+		case methodNotificationMessage:
+			var params mcp.LoggingMessageNotificationParams
+			if err := remarshal(notification.Params, &params); err != nil {
+				slog.Warn("invalid log notification", slog.String("server", name), slog.String("error", err.Error()))
+				return
+			}
+			observer.OnLog(c, name, params)
+		}
+	}
+}
+
+// remarshal converts the params of the notification to v.
+func remarshal(params mcp.NotificationParams, v any) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// clientOptions returns the options to handle the requests from the server as configured.
+//
+//   - roots: The handler of the roots shared by the clients of the server after restart. nil if not configured.
+//   - c: Returns the client the requests are attributed to.
+func clientOptions(name string, server config.MCPServerConfig, handlers *handlers, roots *rootsHandler, c func() client.MCPClient) []client.ClientOption {
+	var options []client.ClientOption
+	if roots != nil {
+		options = append(options, client.WithRootsHandler(roots))
+	}
+	if server.Sampling != nil {
+		options = append(options, client.WithSamplingHandler(&samplingHandler{
+			server:   name,
+			config:   *server.Sampling,
+			handlers: handlers,
+			client:   c,
+		}))
+	}
+	// sse transport cannot receive the requests from the server
+	if server.Transport() != config.TransportSSE {
+		options = append(options, client.WithElicitationHandler(&elicitationHandler{
+			server:   name,
+			handlers: handlers,
+			client:   c,
+		}))
+	}
+	return options
+}
@@ -0,0 +1,543 @@
+package mcpclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	// tokenExpiryDelta is how long before the expiry an access token is renewed.
+	tokenExpiryDelta = 30 * time.Second
+	// oauthRequestTimeout is the timeout for requests to the authorization server.
+	oauthRequestTimeout = 30 * time.Second
+	// maxOAuthResponseSize is the maximum size of a response from the authorization server.
+	maxOAuthResponseSize = 1 << 20
+)
+
+// ErrNotLinked is returned when the user has not linked the account of the MCP server, or the authorization is revoked.
+var ErrNotLinked = errors.New("account is not linked")
+
+// resourceMetadataParam extracts `resource_metadata` parameter from `WWW-Authenticate` header. See: RFC 9728 Section 5.1
+var resourceMetadataParam = regexp.MustCompile(`resource_metadata="([^"]*)"`)
+
+// oauthTransport is http.RoundTripper that authorizes the requests to the MCP server with OAuth 2.1 access token.
+type oauthTransport struct {
+	base   http.RoundTripper
+	tokens *tokenSource
+}
+
+// newOAuthTransport returns a new instance of oauthTransport.
+//
+//   - base: The transport to send the requests to the MCP server.
+//   - tokens: The source of the access tokens.
+func newOAuthTransport(base http.RoundTripper, tokens *tokenSource) *oauthTransport {
+	return &oauthTransport{
+		base:   base,
+		tokens: tokens,
+	}
+}
+
+func (t *oauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.tokens.token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(authorize(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// the access token may be revoked before its expiry. retry once with a new one.
+	if m := resourceMetadataParam.FindStringSubmatch(resp.Header.Get("WWW-Authenticate")); m != nil {
+		t.tokens.setResourceMetadataURL(m[1])
+	}
+	if err := t.tokens.invalidate(req.Context(), token); err != nil {
+		return resp, nil
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	if token, err = t.tokens.token(req.Context()); err != nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+	return t.base.RoundTrip(authorize(retry, token))
+}
+
+// authorize returns a clone of req with the access token.
+func authorize(req *http.Request, token *transport.Token) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	return req
+}
+
+// tokenSource obtains access tokens from the authorization server of the MCP server, and renews them on expiry.
+type tokenSource struct {
+	name      string
+	serverURL string
+	cfg       config.OAuthConfig
+	store     transport.TokenStore
+	// resourceClient sends the requests to the MCP server with its TLS settings.
+	resourceClient *http.Client
+	// httpClient sends the requests to the other hosts, such as the authorization server.
+	httpClient *http.Client
+
+	// mu serializes the requests to the authorization server.
+	mu                  sync.Mutex
+	resourceMetadataURL string
+	metadata            *transport.AuthServerMetadata
+}
+
+// newTokenSource returns a new instance of tokenSource.
+//
+//   - resourceClient: The client to send the requests to the MCP server, such as to fetch the protected resource metadata.
+//     the requests to the authorization server on another host are sent without the TLS settings of the MCP server.
+//   - name: The name of the MCP server.
+//   - serverURL: The endpoint of the MCP server.
+//   - store: The store of the tokens. if nil, tokens are stored in cfg.TokenFile, or in memory if it is empty.
+func newTokenSource(resourceClient *http.Client, name, serverURL string, cfg config.OAuthConfig, store transport.TokenStore) *tokenSource {
+	switch {
+	case store != nil:
+	case cfg.TokenFile != "":
+		store = &fileTokenStore{path: cfg.TokenFile}
+	default:
+		store = transport.NewMemoryTokenStore()
+	}
+	return &tokenSource{
+		name:           name,
+		serverURL:      serverURL,
+		cfg:            cfg,
+		store:          store,
+		resourceClient: resourceClient,
+		httpClient:     &http.Client{},
+	}
+}
+
+// token returns a valid access token.
+func (s *tokenSource) token(ctx context.Context) (*transport.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.store.GetToken(ctx)
+	switch {
+	case errors.Is(err, transport.ErrNoToken):
+		token = nil
+	case err != nil:
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to load oauth token: %s", s.name))
+	case token.AccessToken != "" && (token.ExpiresAt.IsZero() || time.Now().Add(tokenExpiryDelta).Before(token.ExpiresAt)):
+		return token, nil
+	}
+
+	if s.cfg.Grant() == config.OAuthGrantClientCredentials {
+		return s.requestToken(ctx, url.Values{"grant_type": {config.OAuthGrantClientCredentials}})
+	}
+
+	// prefer the refresh token issued last, as the authorization server may rotate refresh tokens.
+	// the configured one is used as fallback so that re-provisioning takes effect without removing the token file.
+	var refreshTokens []string
+	if token != nil && token.RefreshToken != "" {
+		refreshTokens = append(refreshTokens, token.RefreshToken)
+	}
+	if s.cfg.RefreshToken != "" && (token == nil || token.RefreshToken != s.cfg.RefreshToken) {
+		refreshTokens = append(refreshTokens, s.cfg.RefreshToken)
+	}
+	if len(refreshTokens) == 0 {
+		if s.cfg.Grant() == config.OAuthGrantAuthorizationCode {
+			return nil, ErrNotLinked
+		}
+		return nil, fmt.Errorf("no refresh token available: %s", s.name)
+	}
+	for i, refreshToken := range refreshTokens {
+		token, err = s.requestToken(ctx, url.Values{
+			"grant_type":    {config.OAuthGrantRefreshToken},
+			"refresh_token": {refreshToken},
+		})
+		if err == nil {
+			return token, nil
+		}
+		if i < len(refreshTokens)-1 {
+			slog.WarnContext(ctx, "failed to refresh oauth token. retry with the configured refresh token",
+				slog.String("name", s.name),
+				slog.String("error", err.Error()))
+		}
+	}
+	if s.cfg.Grant() == config.OAuthGrantAuthorizationCode && errors.As(err, new(transport.OAuthError)) {
+		// the authorization is revoked or expired. the user must link the account again.
+		return nil, errors.Wrap(ErrNotLinked, err.Error())
+	}
+	return nil, err
+}
+
+// authorizationURL returns the URL to request the authorization of the user with PKCE. See: RFC 7636
+//
+//   - state: The opaque value to bind the callback to the request.
+//   - verifier: The code verifier of PKCE.
+//   - redirectURI: The URI to receive the authorization code.
+func (s *tokenSource) authorizationURL(ctx context.Context, state, verifier, redirectURI string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, oauthRequestTimeout)
+	defer cancel()
+	metadata, err := s.discover(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("failed to discover authorization server: %s", s.name))
+	}
+	if metadata.AuthorizationEndpoint == "" {
+		return "", fmt.Errorf("authorization server has no authorization endpoint: %s", s.name)
+	}
+	u, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("invalid authorization endpoint: %s", metadata.AuthorizationEndpoint))
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", s.cfg.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("state", state)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	query.Set("resource", s.serverURL)
+	if len(s.cfg.Scopes) > 0 {
+		query.Set("scope", strings.Join(s.cfg.Scopes, " "))
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// exchangeCode exchanges the authorization code for tokens and saves them to the store.
+func (s *tokenSource) exchangeCode(ctx context.Context, code, verifier, redirectURI string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.requestToken(ctx, url.Values{
+		"grant_type":    {config.OAuthGrantAuthorizationCode},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {redirectURI},
+	})
+	return err
+}
+
+// invalidate discards the access token rejected by the MCP server, keeping the refresh token.
+func (s *tokenSource) invalidate(ctx context.Context, rejected *transport.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.store.GetToken(ctx)
+	if err != nil {
+		return err
+	}
+	if token.AccessToken != rejected.AccessToken {
+		// already renewed by another request
+		return nil
+	}
+	invalidated := *token
+	invalidated.AccessToken = ""
+	return s.store.SaveToken(ctx, &invalidated)
+}
+
+// setResourceMetadataURL sets the URL of the protected resource metadata advertised by the MCP server,
+// and discards the authorization server metadata discovered from another one.
+func (s *tokenSource) setResourceMetadataURL(u string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resourceMetadataURL == u {
+		return
+	}
+	s.resourceMetadataURL = u
+	if s.cfg.AuthServerMetadataURL == "" {
+		s.metadata = nil
+	}
+}
+
+// requestToken requests an access token to the token endpoint and saves it to the store.
+func (s *tokenSource) requestToken(ctx context.Context, form url.Values) (*transport.Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, oauthRequestTimeout)
+	defer cancel()
+
+	metadata, err := s.discover(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to discover authorization server: %s", s.name))
+	}
+	if len(s.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.cfg.Scopes, " "))
+	}
+	// bind the token to the MCP server. See: RFC 8707
+	form.Set("resource", s.serverURL)
+	useBasicAuth := s.cfg.ClientSecret != "" && supportsBasicAuth(metadata)
+	if !useBasicAuth {
+		form.Set("client_id", s.cfg.ClientID)
+		if s.cfg.ClientSecret != "" {
+			form.Set("client_secret", s.cfg.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to create token request: %s", s.name))
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasicAuth {
+		req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+	}
+	resp, err := s.clientFor(metadata.TokenEndpoint).Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to request token: %s", s.name))
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxOAuthResponseSize))
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to read token response: %s", s.name))
+	}
+
+	var oauthErr transport.OAuthError
+	if err := json.Unmarshal(body, &oauthErr); err == nil && oauthErr.ErrorCode != "" {
+		return nil, errors.Wrap(oauthErr, fmt.Sprintf("token request is rejected: %s", s.name))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, s.name)
+	}
+	var token transport.Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to decode token response: %s", s.name))
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token response has no access token: %s", s.name)
+	}
+	if token.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = form.Get("refresh_token")
+	}
+	if err := s.store.SaveToken(ctx, &token); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to save oauth token: %s", s.name))
+	}
+	slog.InfoContext(ctx, "obtained oauth token",
+		slog.String("name", s.name),
+		slog.String("grantType", form.Get("grant_type")),
+		slog.Time("expiresAt", token.ExpiresAt))
+	return &token, nil
+}
+
+// discover returns the metadata of the authorization server of the MCP server.
+//
+// the authorization server is discovered from the protected resource metadata of the MCP server (RFC 9728),
+// and its metadata is fetched from the well-known URIs of OAuth 2.0 (RFC 8414) or OpenID Connect.
+// falls back to the default endpoints on the MCP server if not found.
+func (s *tokenSource) discover(ctx context.Context) (*transport.AuthServerMetadata, error) {
+	if s.metadata != nil {
+		return s.metadata, nil
+	}
+	if s.cfg.AuthServerMetadataURL != "" {
+		var metadata transport.AuthServerMetadata
+		found, err := s.getJSON(ctx, s.cfg.AuthServerMetadataURL, &metadata)
+		if err != nil {
+			return nil, err
+		}
+		if !found || metadata.TokenEndpoint == "" {
+			return nil, fmt.Errorf("no token endpoint in authorization server metadata: %s", s.cfg.AuthServerMetadataURL)
+		}
+		s.metadata = &metadata
+		return s.metadata, nil
+	}
+
+	issuer, err := origin(s.serverURL)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []string{s.resourceMetadataURL}
+	if s.resourceMetadataURL == "" {
+		candidates = wellKnownURLs(s.serverURL, "oauth-protected-resource")
+	}
+	for _, u := range candidates {
+		var resource struct {
+			AuthorizationServers []string `json:"authorization_servers"`
+		}
+		found, err := s.getJSON(ctx, u, &resource)
+		if err != nil {
+			return nil, err
+		}
+		if found && len(resource.AuthorizationServers) > 0 {
+			issuer = resource.AuthorizationServers[0]
+			break
+		}
+	}
+
+	candidates = append(wellKnownURLs(issuer, "oauth-authorization-server"), wellKnownURLs(issuer, "openid-configuration")...)
+	candidates = append(candidates, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration")
+	for _, u := range candidates {
+		var metadata transport.AuthServerMetadata
+		found, err := s.getJSON(ctx, u, &metadata)
+		if err != nil {
+			return nil, err
+		}
+		if found && metadata.TokenEndpoint != "" {
+			s.metadata = &metadata
+			return s.metadata, nil
+		}
+	}
+
+	base, err := origin(issuer)
+	if err != nil {
+		return nil, err
+	}
+	slog.WarnContext(ctx, "authorization server metadata not found. use the default token endpoint",
+		slog.String("name", s.name),
+		slog.String("issuer", issuer))
+	s.metadata = &transport.AuthServerMetadata{Issuer: issuer, TokenEndpoint: base + "/token"}
+	return s.metadata, nil
+}
+
+// getJSON fetches the JSON document at u into v. returns false if the document does not exist.
+func (s *tokenSource) getJSON(ctx context.Context, u string, v any) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("failed to create request: %s", u))
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.clientFor(u).Do(req)
+	if err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("failed to fetch %s", u))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOAuthResponseSize)).Decode(v); err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("failed to decode %s", u))
+	}
+	return true, nil
+}
+
+// clientFor returns the client to send the requests to u.
+// the TLS settings of the MCP server, such as the client certificate, are only used for the requests to the MCP server.
+func (s *tokenSource) clientFor(u string) *http.Client {
+	serverOrigin, err := origin(s.serverURL)
+	if err != nil {
+		return s.httpClient
+	}
+	if o, err := origin(u); err == nil && o == serverOrigin {
+		return s.resourceClient
+	}
+	return s.httpClient
+}
+
+// supportsBasicAuth reports whether the authorization server accepts client_secret_basic authentication.
+// it is the default when token_endpoint_auth_methods_supported is omitted. See: RFC 8414 Section 2
+func supportsBasicAuth(metadata *transport.AuthServerMetadata) bool {
+	methods := metadata.TokenEndpointAuthMethodsSupported
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if m == "client_secret_basic" {
+			return true
+		}
+	}
+	return false
+}
+
+// origin returns the scheme and host of rawURL.
+func origin(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("invalid url: %s", rawURL))
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// wellKnownURLs returns the well-known URIs for rawURL, with the path inserted after `/.well-known/<name>` first,
+// followed by the one at the root.
+func wellKnownURLs(rawURL, name string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	root := u.Scheme + "://" + u.Host + "/.well-known/" + name
+	if path := strings.TrimSuffix(u.Path, "/"); path != "" {
+		return []string{root + path, root}
+	}
+	return []string{root}
+}
+
+// fileTokenStore is transport.TokenStore that persists the token to a file.
+type fileTokenStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (s *fileTokenStore) GetToken(ctx context.Context) (*transport.Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, transport.ErrNoToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	var token transport.Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to decode token file: %s", s.path))
+	}
+	return &token, nil
+}
+
+func (s *fileTokenStore) SaveToken(ctx context.Context, token *transport.Token) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	// write to a temporary file and rename it, not to leave a broken token file on failure.
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
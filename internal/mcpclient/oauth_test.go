@@ -0,0 +1,312 @@
+package mcpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+)
+
+// recordingTransport is http.RoundTripper that records the hosts of the requests.
+type recordingTransport struct {
+	mu    sync.Mutex
+	hosts []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.hosts = append(t.hosts, req.URL.Host)
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newJSONServer starts the server responding with the documents keyed by path, and 404 for the others.
+// docs takes the URL of the server itself.
+func newJSONServer(t *testing.T, docs func(serverURL string) map[string]any) *httptest.Server {
+	t.Helper()
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := docs(ts.URL)[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doc)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestTokenSource_Discover(t *testing.T) {
+	tests := []struct {
+		name string
+		// path is the path of the endpoint of the MCP server.
+		path string
+		// mcp returns the documents of the MCP server.
+		mcp func(authURL string) map[string]any
+		// auth returns the documents of the authorization server.
+		auth func(authURL string) map[string]any
+		// metadataURL returns the configured URL of the authorization server metadata.
+		metadataURL func(authURL string) string
+		// want returns the expected token endpoint.
+		want func(mcpURL, authURL string) string
+	}{
+		{
+			name: "protected resource metadata",
+			path: "/mcp",
+			mcp: func(authURL string) map[string]any {
+				return map[string]any{
+					"/.well-known/oauth-protected-resource/mcp": map[string]any{"authorization_servers": []string{authURL}},
+				}
+			},
+			auth: func(authURL string) map[string]any {
+				return map[string]any{
+					"/.well-known/oauth-authorization-server": map[string]any{"issuer": authURL, "token_endpoint": authURL + "/oauth/token"},
+				}
+			},
+			want: func(mcpURL, authURL string) string { return authURL + "/oauth/token" },
+		},
+		{
+			name: "protected resource metadata at the root",
+			path: "/mcp",
+			mcp: func(authURL string) map[string]any {
+				return map[string]any{
+					"/.well-known/oauth-protected-resource": map[string]any{"authorization_servers": []string{authURL + "/tenant"}},
+				}
+			},
+			auth: func(authURL string) map[string]any {
+				return map[string]any{
+					"/.well-known/openid-configuration/tenant": map[string]any{"issuer": authURL + "/tenant", "token_endpoint": authURL + "/tenant/token"},
+				}
+			},
+			want: func(mcpURL, authURL string) string { return authURL + "/tenant/token" },
+		},
+		{
+			name: "openid configuration appended to the issuer",
+			path: "/",
+			mcp: func(authURL string) map[string]any {
+				return map[string]any{
+					"/.well-known/oauth-protected-resource": map[string]any{"authorization_servers": []string{authURL + "/realms/mcp"}},
+				}
+			},
+			auth: func(authURL string) map[string]any {
+				return map[string]any{
+					"/realms/mcp/.well-known/openid-configuration": map[string]any{"issuer": authURL + "/realms/mcp", "token_endpoint": authURL + "/realms/mcp/token"},
+				}
+			},
+			want: func(mcpURL, authURL string) string { return authURL + "/realms/mcp/token" },
+		},
+		{
+			name: "configured metadata url",
+			path: "/mcp",
+			mcp:  func(authURL string) map[string]any { return nil },
+			auth: func(authURL string) map[string]any {
+				return map[string]any{
+					"/metadata": map[string]any{"issuer": authURL, "token_endpoint": authURL + "/configured/token"},
+				}
+			},
+			metadataURL: func(authURL string) string { return authURL + "/metadata" },
+			want:        func(mcpURL, authURL string) string { return authURL + "/configured/token" },
+		},
+		{
+			name: "default endpoint on the MCP server",
+			path: "/mcp",
+			mcp:  func(authURL string) map[string]any { return nil },
+			auth: func(authURL string) map[string]any { return nil },
+			want: func(mcpURL, authURL string) string { return mcpURL + "/token" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := newJSONServer(t, tt.auth)
+			mcp := newJSONServer(t, func(string) map[string]any { return tt.mcp(auth.URL) })
+			var cfg config.OAuthConfig
+			if tt.metadataURL != nil {
+				cfg.AuthServerMetadataURL = tt.metadataURL(auth.URL)
+			}
+			resource := &recordingTransport{}
+			s := newTokenSource(&http.Client{Transport: resource}, "test", mcp.URL+tt.path, cfg, nil)
+
+			metadata, err := s.discover(context.Background())
+			if err != nil {
+				t.Fatalf("discover() error = %v", err)
+			}
+			if want := tt.want(mcp.URL, auth.URL); metadata.TokenEndpoint != want {
+				t.Errorf("discover() token endpoint = %q, want %q", metadata.TokenEndpoint, want)
+			}
+			authHost, _ := url.Parse(auth.URL)
+			for _, host := range resource.hosts {
+				if host == authHost.Host {
+					t.Errorf("the authorization server %s is requested with the client of the MCP server", host)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenSource_Token(t *testing.T) {
+	expired := &transport.Token{AccessToken: "expired", RefreshToken: "stored", ExpiresAt: time.Now().Add(-time.Minute)}
+	tests := []struct {
+		name string
+		cfg  config.OAuthConfig
+		// stored is the token in the store before the request.
+		stored *transport.Token
+		// rejected are the refresh tokens the authorization server rejects.
+		rejected []string
+		// response is the token issued by the authorization server.
+		response map[string]any
+		// wantForm is the form expected by the token endpoint.
+		wantForm url.Values
+		// wantRequests is the number of the requests to the token endpoint.
+		wantRequests int
+		want         transport.Token
+	}{
+		{
+			name:         "valid token",
+			cfg:          config.OAuthConfig{ClientID: "client", RefreshToken: "configured"},
+			stored:       &transport.Token{AccessToken: "valid", RefreshToken: "stored", ExpiresAt: time.Now().Add(time.Hour)},
+			wantRequests: 0,
+			want:         transport.Token{AccessToken: "valid", RefreshToken: "stored"},
+		},
+		{
+			name:     "refresh with the stored refresh token",
+			cfg:      config.OAuthConfig{ClientID: "client", RefreshToken: "configured"},
+			stored:   expired,
+			response: map[string]any{"access_token": "renewed", "token_type": "Bearer", "expires_in": 3600},
+			wantForm: url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {"stored"},
+				"client_id":     {"client"},
+			},
+			wantRequests: 1,
+			// the refresh token is kept if the authorization server does not rotate it
+			want: transport.Token{AccessToken: "renewed", RefreshToken: "stored"},
+		},
+		{
+			name:     "rotated refresh token",
+			cfg:      config.OAuthConfig{ClientID: "client", RefreshToken: "configured"},
+			stored:   expired,
+			response: map[string]any{"access_token": "renewed", "refresh_token": "rotated", "expires_in": 3600},
+			wantForm: url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {"stored"},
+				"client_id":     {"client"},
+			},
+			wantRequests: 1,
+			want:         transport.Token{AccessToken: "renewed", RefreshToken: "rotated"},
+		},
+		{
+			name:     "fall back to the configured refresh token",
+			cfg:      config.OAuthConfig{ClientID: "client", RefreshToken: "configured", Scopes: []string{"read", "write"}},
+			stored:   expired,
+			rejected: []string{"stored"},
+			response: map[string]any{"access_token": "renewed", "expires_in": 3600},
+			wantForm: url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {"configured"},
+				"client_id":     {"client"},
+				"scope":         {"read write"},
+			},
+			wantRequests: 2,
+			want:         transport.Token{AccessToken: "renewed", RefreshToken: "configured"},
+		},
+		{
+			name:     "client credentials",
+			cfg:      config.OAuthConfig{ClientID: "client", ClientSecret: "secret"},
+			response: map[string]any{"access_token": "issued", "expires_in": 3600},
+			wantForm: url.Values{
+				"grant_type": {"client_credentials"},
+			},
+			wantRequests: 1,
+			want:         transport.Token{AccessToken: "issued"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				form     url.Values
+				requests int
+			)
+			var ts *httptest.Server
+			ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/.well-known/oauth-authorization-server":
+					json.NewEncoder(w).Encode(map[string]any{"issuer": ts.URL, "token_endpoint": ts.URL + "/token"})
+				case "/token":
+					r.ParseForm()
+					mu.Lock()
+					requests++
+					form = r.PostForm
+					mu.Unlock()
+					for _, rejected := range tt.rejected {
+						if r.PostForm.Get("refresh_token") == rejected {
+							w.WriteHeader(http.StatusBadRequest)
+							json.NewEncoder(w).Encode(map[string]any{"error": "invalid_grant"})
+							return
+						}
+					}
+					if user, password, ok := r.BasicAuth(); ok && (user != tt.cfg.ClientID || password != tt.cfg.ClientSecret) {
+						w.WriteHeader(http.StatusUnauthorized)
+						json.NewEncoder(w).Encode(map[string]any{"error": "invalid_client"})
+						return
+					}
+					json.NewEncoder(w).Encode(tt.response)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer ts.Close()
+
+			store := transport.NewMemoryTokenStore()
+			if tt.stored != nil {
+				store.SaveToken(context.Background(), tt.stored)
+			}
+			s := newTokenSource(&http.Client{}, "test", ts.URL+"/mcp", tt.cfg, store)
+			token, err := s.token(context.Background())
+			if err != nil {
+				t.Fatalf("token() error = %v", err)
+			}
+			if token.AccessToken != tt.want.AccessToken || token.RefreshToken != tt.want.RefreshToken {
+				t.Errorf("token() = %q, %q, want %q, %q", token.AccessToken, token.RefreshToken, tt.want.AccessToken, tt.want.RefreshToken)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("token endpoint received %d requests, want %d", requests, tt.wantRequests)
+			}
+			if tt.wantRequests == 0 {
+				return
+			}
+			if !time.Now().Before(token.ExpiresAt) {
+				t.Errorf("token() expires at %v, want in the future", token.ExpiresAt)
+			}
+			for key, want := range tt.wantForm {
+				if got := form[key]; len(got) != 1 || got[0] != want[0] {
+					t.Errorf("form %s = %v, want %v", key, got, want)
+				}
+			}
+			if got := form.Get("resource"); got != ts.URL+"/mcp" {
+				t.Errorf("form resource = %q, want %q", got, ts.URL+"/mcp")
+			}
+			saved, err := store.GetToken(context.Background())
+			if err != nil || saved.AccessToken != tt.want.AccessToken {
+				t.Errorf("saved token = %+v, %v, want %q", saved, err, tt.want.AccessToken)
+			}
+		})
+	}
+}
+
+func TestTokenSource_Token_NotLinked(t *testing.T) {
+	s := newTokenSource(&http.Client{}, "test", "http://127.0.0.1/mcp", config.OAuthConfig{GrantType: config.OAuthGrantAuthorizationCode}, nil)
+	if _, err := s.token(context.Background()); err != ErrNotLinked {
+		t.Errorf("token() error = %v, want %v", err, ErrNotLinked)
+	}
+}
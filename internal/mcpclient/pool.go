@@ -0,0 +1,201 @@
+package mcpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcphost/pkg/llm"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/miyamo2/slackbot-mcp-host/internal/toolname"
+)
+
+// server represents a running MCP server.
+type server struct {
+	config     config.MCPServerConfig
+	supervisor *Supervisor
+}
+
+// Pool holds the MCP clients of the configured servers.
+// it also serves as the registry of their tools, which are kept up to date while the servers are running.
+type Pool struct {
+	// applyMu serializes Apply and Close, so that mu is held only to read and swap the servers.
+	applyMu  sync.Mutex
+	mu       sync.Mutex
+	servers  map[string]*server
+	handlers handlers
+	names    *toolname.Registry
+}
+
+// NewPool returns a new instance of Pool.
+//
+//   - names: The registry naming the tools sent to the LLM.
+func NewPool(names *toolname.Registry) *Pool {
+	return &Pool{
+		servers: make(map[string]*server),
+		names:   names,
+	}
+}
+
+// Apply reconciles the running servers with the given configuration.
+// Only servers that are added or changed are started, and only servers that are removed or changed are stopped.
+// Per-user servers are ignored, as they are started by UserPool.
+//
+// The servers are started concurrently. Apply waits only for the required servers,
+// and the optional servers are started in background and retried with backoff until they are ready.
+// The clients of the stopped servers are returned instead of being closed,
+// so that sessions still using them can finish. The caller must close them.
+// If a changed required server fails to start, the previous one keeps running.
+// The running servers keep serving the sessions while the servers are started, and are swapped at the end.
+// Apply returns the errors of all required servers that failed to start.
+func (p *Pool) Apply(ctx context.Context, servers map[string]config.MCPServerConfig) (stale []client.MCPClient, err error) {
+	p.applyMu.Lock()
+	defer p.applyMu.Unlock()
+
+	p.mu.Lock()
+	current := maps.Clone(p.servers)
+	p.mu.Unlock()
+
+	started := make(map[string]*server)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for name, cfg := range servers {
+		if cfg.PerUser {
+			continue
+		}
+		if s, ok := current[name]; ok && reflect.DeepEqual(s.config, cfg) {
+			continue
+		}
+		var supervisor *Supervisor
+		// the requests from the server are attributed to the supervisor, which the sessions use
+		attributed := func() client.MCPClient { return supervisor }
+		roots := newRootsHandler(name, cfg, &p.handlers, attributed)
+		supervisor = newSupervisor(ctx, name, p.names, cfg.Tools, roots, func(ctx context.Context) (client.MCPClient, error) {
+			return New(ctx, name, cfg, clientOptions(name, cfg, &p.handlers, roots, attributed)...)
+		})
+		supervisor.OnNotification(observe(name, &p.handlers, supervisor))
+		if !cfg.Required {
+			slog.InfoContext(ctx, "start optional mcp server in background", slog.String("name", name))
+			supervisor.StartBackground()
+			started[name] = &server{config: cfg, supervisor: supervisor}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := supervisor.Start(ctx); err != nil {
+				supervisor.Close()
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				return
+			}
+			slog.InfoContext(ctx, "added tools from mcp client", slog.String("server", name), slog.Any("tools", supervisor.Tools()))
+			mu.Lock()
+			started[name] = &server{config: cfg, supervisor: supervisor}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, s := range p.servers {
+		if cfg, ok := servers[name]; ok && !cfg.PerUser {
+			continue
+		}
+		slog.InfoContext(ctx, "stop mcp server", slog.String("name", name))
+		stale = append(stale, s.supervisor)
+		delete(p.servers, name)
+	}
+	for name, s := range started {
+		if current, ok := p.servers[name]; ok {
+			slog.InfoContext(ctx, "restart mcp server", slog.String("name", name))
+			stale = append(stale, current.supervisor)
+		}
+		p.servers[name] = s
+	}
+	if len(errs) > 0 {
+		return stale, fmt.Errorf("failed to start required mcp servers: %w", errors.Join(errs...))
+	}
+	return stale, nil
+}
+
+// Clients returns the clients of the running servers keyed by server name.
+func (p *Pool) Clients() map[string]client.MCPClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clients := make(map[string]client.MCPClient, len(p.servers))
+	for name, s := range p.servers {
+		clients[name] = s.supervisor
+	}
+	return clients
+}
+
+// Tools returns the current tools of all running servers.
+// the tools changed by restarts or notifications from the servers are reflected immediately.
+func (p *Pool) Tools() []llm.Tool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var tools []llm.Tool
+	for _, s := range p.servers {
+		tools = slices.Concat(tools, s.supervisor.Tools())
+	}
+	return tools
+}
+
+// States returns the states of the running servers keyed by server name.
+func (p *Pool) States() map[string]State {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	states := make(map[string]State, len(p.servers))
+	for name, s := range p.servers {
+		states[name], _ = s.supervisor.State()
+	}
+	return states
+}
+
+// SetSampler sets the sampler for the sampling requests from the servers.
+func (p *Pool) SetSampler(sampler Sampler) {
+	p.handlers.setSampler(sampler)
+}
+
+// SetElicitor sets the elicitor for the elicitation requests from the servers.
+func (p *Pool) SetElicitor(elicitor Elicitor) {
+	p.handlers.setElicitor(elicitor)
+}
+
+// SetObserver sets the observer for the notifications from the servers.
+func (p *Pool) SetObserver(observer Observer) {
+	p.handlers.setObserver(observer)
+}
+
+// SetChannelResolver sets the resolver of the Slack channels the tool calls are made from.
+func (p *Pool) SetChannelResolver(resolver ChannelResolver) {
+	p.handlers.setChannelResolver(resolver)
+}
+
+// Close stops all running servers.
+func (p *Pool) Close() error {
+	p.applyMu.Lock()
+	defer p.applyMu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for name, s := range p.servers {
+		if err := s.supervisor.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close mcp client: %s: %w", name, err))
+		}
+		delete(p.servers, name)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+package mcpclient
+
+import (
+	"context"
+	"maps"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/miyamo2/slackbot-mcp-host/internal/toolname"
+)
+
+// newTestHTTPServer starts the streamable HTTP server with the echo tool, and returns its configuration.
+func newTestHTTPServer(t *testing.T, required bool) config.MCPServerConfig {
+	t.Helper()
+	ts := httptest.NewServer(mcpserver.NewStreamableHTTPServer(newTestMCPServer()))
+	t.Cleanup(ts.Close)
+	return config.MCPServerConfig{Type: config.TransportStreamableHTTP, URL: ts.URL, Required: required}
+}
+
+// closeAll closes the stale clients returned by Apply.
+func closeAll(stale []client.MCPClient) {
+	for _, c := range stale {
+		c.Close()
+	}
+}
+
+func TestPool_Apply(t *testing.T) {
+	ctx := context.Background()
+	names := toolname.NewRegistry(toolname.RuleOf(config.LLMProviderAnthropic))
+	p := NewPool(names)
+	t.Cleanup(func() { p.Close() })
+
+	kept := newTestHTTPServer(t, true)
+	changed := newTestHTTPServer(t, true)
+	stale, err := p.Apply(ctx, map[string]config.MCPServerConfig{
+		"kept":    kept,
+		"changed": changed,
+		"user":    {Type: config.TransportStreamableHTTP, URL: "http://127.0.0.1:0", PerUser: true},
+	})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(stale) != 0 {
+		t.Errorf("Apply() stale = %d clients, want none", len(stale))
+	}
+	before := p.Clients()
+	if got := slices.Sorted(maps.Keys(before)); !slices.Equal(got, []string{"changed", "kept"}) {
+		t.Fatalf("Clients() = %v, want [changed kept] without per-user servers", got)
+	}
+	for name, state := range p.States() {
+		if state != StateReady {
+			t.Errorf("States()[%s] = %s, want %s", name, state, StateReady)
+		}
+	}
+	var tools []string
+	for _, tool := range p.Tools() {
+		tools = append(tools, tool.Name)
+	}
+	slices.Sort(tools)
+	if !slices.Equal(tools, []string{"changed__echo", "kept__echo"}) {
+		t.Errorf("Tools() = %v, want [changed__echo kept__echo]", tools)
+	}
+
+	// the unchanged server keeps running, and the changed one is restarted
+	changed.Headers = map[string]string{"X-Test": "value"}
+	stale, err = p.Apply(ctx, map[string]config.MCPServerConfig{"kept": kept, "changed": changed})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	after := p.Clients()
+	if after["kept"] != before["kept"] {
+		t.Error("unchanged server is restarted")
+	}
+	if after["changed"] == before["changed"] {
+		t.Error("changed server is not restarted")
+	}
+	if len(stale) != 1 || stale[0] != before["changed"] {
+		t.Errorf("Apply() stale = %v, want the previous changed server", stale)
+	}
+	closeAll(stale)
+	if _, _, ok := names.Resolve("changed__echo"); !ok {
+		t.Error("Resolve() of restarted server = false, want true while the new one offers it")
+	}
+
+	// the removed server is stopped
+	stale, err = p.Apply(ctx, map[string]config.MCPServerConfig{"kept": kept})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(stale) != 1 || stale[0] != after["changed"] {
+		t.Errorf("Apply() stale = %v, want the removed server", stale)
+	}
+	closeAll(stale)
+	if _, _, ok := names.Resolve("changed__echo"); ok {
+		t.Error("Resolve() of removed server = true, want false after closing it")
+	}
+	if got := slices.Sorted(maps.Keys(p.Clients())); !slices.Equal(got, []string{"kept"}) {
+		t.Errorf("Clients() = %v, want [kept]", got)
+	}
+}
+
+func TestPool_Apply_RequiredFails(t *testing.T) {
+	ctx := context.Background()
+	p := NewPool(toolname.NewRegistry(toolname.RuleOf(config.LLMProviderAnthropic)))
+	t.Cleanup(func() { p.Close() })
+
+	server := newTestHTTPServer(t, true)
+	if _, err := p.Apply(ctx, map[string]config.MCPServerConfig{"srv": server}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	before := p.Clients()["srv"]
+
+	down := httptest.NewServer(nil)
+	down.Close()
+	broken := config.MCPServerConfig{Type: config.TransportStreamableHTTP, URL: down.URL, Required: true}
+	optional := config.MCPServerConfig{Type: config.TransportStreamableHTTP, URL: down.URL}
+	stale, err := p.Apply(ctx, map[string]config.MCPServerConfig{"srv": broken, "optional": optional})
+	if err == nil {
+		t.Error("Apply() error = nil, want the error of the required server")
+	}
+	if len(stale) != 0 {
+		t.Errorf("Apply() stale = %d clients, want none", len(stale))
+	}
+	// the previous server keeps running if the changed one fails to start
+	if got := p.Clients()["srv"]; got != before {
+		t.Error("previous server is replaced by the one failed to start")
+	}
+	// the optional server is started in background
+	if state := p.States()["optional"]; state != StateStarting {
+		t.Errorf("States()[optional] = %s, want %s", state, StateStarting)
+	}
+}
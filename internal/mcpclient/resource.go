@@ -0,0 +1,172 @@
+package mcpclient
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/goccy/go-json"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcphost/pkg/llm"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ListResourcesTool is the name of the synthetic tool to list the resources of the server.
+	ListResourcesTool = "list_resources"
+	// ReadResourceTool is the name of the synthetic tool to read a resource of the server.
+	ReadResourceTool = "read_resource"
+)
+
+// resourceSummary is a resource or resource template listed to the LLM.
+type resourceSummary struct {
+	URI         string `json:"uri,omitempty"`
+	URITemplate string `json:"uriTemplate,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MIMEType    string `json:"mimeType,omitempty"`
+}
+
+// supportsResources reports whether the server offers resources.
+func supportsResources(c client.MCPClient) bool {
+	cc, ok := c.(*client.Client)
+	return ok && cc.GetServerCapabilities().Resources != nil
+}
+
+// resourceToolsOf returns the synthetic tools to list and read the resources of the server.
+// the tools the server offers with the same names take precedence.
+func resourceToolsOf(mcpServerName string, tools []llm.Tool) []llm.Tool {
+	resourceTools := make([]llm.Tool, 0, 2)
+	for _, tool := range []llm.Tool{
+		{
+			Name: ListResourcesTool,
+			Description: fmt.Sprintf(
+				"List the resources of the %s MCP server, such as files and documents, with their URIs. "+
+					"URI templates are also listed, whose variables in braces are filled to read a resource.",
+				mcpServerName),
+			InputSchema: llm.Schema{
+				Type:       "object",
+				Properties: map[string]any{},
+				Required:   []string{},
+			},
+		},
+		{
+			Name: ReadResourceTool,
+			Description: fmt.Sprintf(
+				"Read the contents of a resource of the %s MCP server by its URI. use %s of the server to find the URIs.",
+				mcpServerName, ListResourcesTool),
+			InputSchema: llm.Schema{
+				Type: "object",
+				Properties: map[string]any{
+					"uri": map[string]any{
+						"type":        "string",
+						"description": "The URI of the resource to read.",
+					},
+				},
+				Required: []string{"uri"},
+			},
+		},
+	} {
+		if containsTool(tools, tool.Name) {
+			slog.Warn("mcp server has a tool with the same name as the synthetic tool. the synthetic tool is skipped",
+				slog.String("server", mcpServerName),
+				slog.String("tool", tool.Name))
+			continue
+		}
+		resourceTools = append(resourceTools, tool)
+	}
+	return resourceTools
+}
+
+// containsTool reports whether tools contains the tool with the name.
+func containsTool(tools []llm.Tool, name string) bool {
+	for _, tool := range tools {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// callResourceTool calls the synthetic tool to list or read the resources with c.
+func callResourceTool(ctx context.Context, c client.MCPClient, mcpServerName string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	switch request.Params.Name {
+	case ListResourcesTool:
+		return listResources(ctx, c, mcpServerName)
+	case ReadResourceTool:
+		uri, _ := request.GetArguments()["uri"].(string)
+		if uri == "" {
+			return mcp.NewToolResultError("uri is required"), nil
+		}
+		return readResource(ctx, c, mcpServerName, uri)
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown resource tool: %s", request.Params.Name))
+	}
+}
+
+// listResources lists the resources and resource templates of the server as JSON.
+func listResources(ctx context.Context, c client.MCPClient, mcpServerName string) (*mcp.CallToolResult, error) {
+	resources, err := c.ListResources(ctx, mcp.ListResourcesRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to list resources: %s", mcpServerName))
+	}
+	summaries := make([]resourceSummary, 0, len(resources.Resources))
+	for _, r := range resources.Resources {
+		summaries = append(summaries, resourceSummary{
+			URI:         r.URI,
+			Name:        r.Name,
+			Description: r.Description,
+			MIMEType:    r.MIMEType,
+		})
+	}
+	// templates are optional for the servers offering resources
+	templates, err := c.ListResourceTemplates(ctx, mcp.ListResourceTemplatesRequest{})
+	if err != nil {
+		slog.WarnContext(ctx, "failed to list resource templates",
+			slog.String("server", mcpServerName),
+			slog.String("error", err.Error()))
+	} else {
+		for _, t := range templates.ResourceTemplates {
+			var uriTemplate string
+			if t.URITemplate != nil && t.URITemplate.Template != nil {
+				uriTemplate = t.URITemplate.Raw()
+			}
+			summaries = append(summaries, resourceSummary{
+				URITemplate: uriTemplate,
+				Name:        t.Name,
+				Description: t.Description,
+				MIMEType:    t.MIMEType,
+			})
+		}
+	}
+	b, err := json.Marshal(summaries)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal resources")
+	}
+	return mcp.NewToolResultText(string(b)), nil
+}
+
+// readResource reads the resource of the server. binary contents are not passed to the LLM, but only described.
+func readResource(ctx context.Context, c client.MCPClient, mcpServerName, uri string) (*mcp.CallToolResult, error) {
+	request := mcp.ReadResourceRequest{}
+	request.Params.URI = uri
+	result, err := c.ReadResource(ctx, request)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to read resource: %s: %s", mcpServerName, uri))
+	}
+	content := make([]mcp.Content, 0, len(result.Contents))
+	for _, rc := range result.Contents {
+		switch rc := rc.(type) {
+		case mcp.TextResourceContents:
+			content = append(content, mcp.NewTextContent(rc.Text))
+		case mcp.BlobResourceContents:
+			content = append(content, mcp.NewTextContent(fmt.Sprintf(
+				"[binary resource %s (%s), %d bytes in base64]", rc.URI, rc.MIMEType, len(rc.Blob))))
+		}
+	}
+	if len(content) == 0 {
+		content = append(content, mcp.NewTextContent(fmt.Sprintf("resource %s is empty", uri)))
+	}
+	return &mcp.CallToolResult{Content: content}, nil
+}
@@ -0,0 +1,84 @@
+package mcpclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	headerLastEventID = "Last-Event-ID"
+	// maxEventIDLineLength is the maximum length of an `id:` line to be buffered.
+	maxEventIDLineLength = 1024
+)
+
+// resumableTransport is http.RoundTripper that resumes the GET stream of a streamable HTTP server
+// from the last received event, by sending `Last-Event-ID` header on reconnection.
+type resumableTransport struct {
+	base        http.RoundTripper
+	mu          sync.Mutex
+	lastEventID string
+}
+
+// newResumableTransport returns a new instance of resumableTransport.
+func newResumableTransport(base http.RoundTripper) *resumableTransport {
+	return &resumableTransport{base: base}
+}
+
+func (t *resumableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+	if id := t.load(); id != "" && req.Header.Get(headerLastEventID) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(headerLastEventID, id)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body = &eventIDReader{ReadCloser: resp.Body, onID: t.store}
+	}
+	return resp, nil
+}
+
+func (t *resumableTransport) load() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastEventID
+}
+
+func (t *resumableTransport) store(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastEventID = id
+}
+
+// eventIDReader passes through an SSE stream and reports the id of each event to onID.
+type eventIDReader struct {
+	io.ReadCloser
+	onID func(id string)
+	// line is the beginning of the current line
+	line []byte
+}
+
+func (r *eventIDReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	for _, b := range p[:n] {
+		switch b {
+		case '\n', '\r':
+			if id, ok := bytes.CutPrefix(r.line, []byte("id:")); ok {
+				r.onID(strings.TrimSpace(string(id)))
+			}
+			r.line = r.line[:0]
+		default:
+			if len(r.line) < maxEventIDLineLength {
+				r.line = append(r.line, b)
+			}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,164 @@
+package mcpclient
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/pkg/errors"
+)
+
+// rootsSyncTimeout is the time to wait for the server to list the roots of the new channel before the tool call.
+const rootsSyncTimeout = 5 * time.Second
+
+// ChannelResolver resolves the Slack channel the tool calls are made from, to advertise the roots of the channel.
+type ChannelResolver interface {
+	// ChannelOf returns the Slack channel ID of the tool call in progress.
+	//
+	//   - c: The client connected to the server, which the call is made with.
+	//   - request: The request of the call.
+	ChannelOf(c client.MCPClient, request mcp.CallToolRequest) (string, bool)
+}
+
+// rootsHandler is client.RootsHandler that advertises the roots of the channel of the tool calls to the server.
+// as the server sees one list of roots at a time, the calls from different channels are serialized,
+// and the server is notified to list the roots again before the call from another channel.
+type rootsHandler struct {
+	server   string
+	config   config.RootsConfig
+	handlers *handlers
+	// client returns the client the calls are attributed to.
+	client func() client.MCPClient
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// channel is the channel whose roots are advertised.
+	channel string
+	// calls is the number of the calls in progress from the channel.
+	calls int
+	// listed is closed when the server lists the roots of the channel, or nil if not waited.
+	listed chan struct{}
+	// lists reports whether the server has ever listed the roots. the servers not using roots are not waited.
+	lists bool
+}
+
+var _ client.RootsHandler = (*rootsHandler)(nil)
+
+// newRootsHandler returns the handler advertising the roots to the server as configured, or nil if not configured.
+//
+//   - c: Returns the client the calls are attributed to.
+func newRootsHandler(name string, server config.MCPServerConfig, handlers *handlers, c func() client.MCPClient) *rootsHandler {
+	// sse transport cannot receive the requests from the server
+	if server.Roots == nil || server.Transport() == config.TransportSSE {
+		return nil
+	}
+	r := &rootsHandler{
+		server:   name,
+		config:   *server.Roots,
+		handlers: handlers,
+		client:   c,
+	}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+func (r *rootsHandler) ListRoots(ctx context.Context, request mcp.ListRootsRequest) (*mcp.ListRootsResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	slog.InfoContext(ctx, "roots listed", slog.String("server", r.server), slog.String("channel", r.channel))
+	r.lists = true
+	if r.listed != nil {
+		close(r.listed)
+		r.listed = nil
+	}
+	configs := r.config.Of(r.channel)
+	result := &mcp.ListRootsResult{Roots: make([]mcp.Root, 0, len(configs))}
+	for _, root := range configs {
+		result.Roots = append(result.Roots, mcp.Root{URI: root.URI, Name: root.Name})
+	}
+	return result, nil
+}
+
+// enter waits until the roots of the channel of the call are advertised to the server connected with c.
+// the caller must call exit when the call finishes.
+func (r *rootsHandler) enter(ctx context.Context, c client.MCPClient, request mcp.CallToolRequest) (exit func(), err error) {
+	var channel string
+	if resolver := r.handlers.getChannelResolver(); resolver != nil {
+		channel, _ = resolver.ChannelOf(r.client(), request)
+	}
+
+	r.mu.Lock()
+	// wake up to give up waiting when ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.cond.Broadcast()
+	})
+	defer stop()
+	for r.calls > 0 && r.channel != channel {
+		if err := ctx.Err(); err != nil {
+			r.mu.Unlock()
+			return nil, err
+		}
+		r.cond.Wait()
+	}
+	r.calls++
+	changed := r.channel != channel
+	if changed {
+		r.channel = channel
+		if r.lists {
+			r.listed = make(chan struct{})
+		}
+	}
+	listed := r.listed
+	r.mu.Unlock()
+
+	exit = func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.calls--
+		if r.calls == 0 {
+			r.cond.Broadcast()
+		}
+	}
+	if changed {
+		slog.InfoContext(ctx, "roots changed", slog.String("server", r.server), slog.String("channel", channel))
+		if err := notifyRootsChanged(ctx, c); err != nil {
+			exit()
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to notify roots changed: %s", r.server))
+		}
+	}
+	if listed != nil {
+		timer := time.NewTimer(rootsSyncTimeout)
+		defer timer.Stop()
+		select {
+		case <-listed:
+		case <-timer.C:
+			slog.WarnContext(ctx, "roots are not listed in time", slog.String("server", r.server), slog.String("channel", channel))
+			// the following calls from the channel do not wait again
+			r.mu.Lock()
+			if r.listed == listed {
+				r.listed = nil
+			}
+			r.mu.Unlock()
+		case <-ctx.Done():
+			exit()
+			return nil, ctx.Err()
+		}
+	}
+	return exit, nil
+}
+
+// notifyRootsChanged notifies the server connected with c that the roots are changed.
+func notifyRootsChanged(ctx context.Context, c client.MCPClient) error {
+	cc, ok := c.(*client.Client)
+	if !ok {
+		return nil
+	}
+	return cc.RootListChanges(ctx)
+}
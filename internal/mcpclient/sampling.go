@@ -0,0 +1,50 @@
+package mcpclient
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/pkg/errors"
+)
+
+// Sampler samples messages from the LLM of the host for the sampling requests from the servers.
+type Sampler interface {
+	// CreateMessage samples a message for the request from the server.
+	//
+	//   - c: The client connected to the server, which the request is attributed to.
+	//   - server: The name of the server.
+	//   - approval: Whether the request must be approved by the user before sampling.
+	CreateMessage(ctx context.Context, c client.MCPClient, server string, approval bool, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error)
+}
+
+// samplingHandler is client.SamplingHandler that forwards the sampling requests from a server to the Sampler.
+type samplingHandler struct {
+	server   string
+	config   config.SamplingConfig
+	handlers *handlers
+	// client returns the client the requests are attributed to.
+	client func() client.MCPClient
+}
+
+var _ client.SamplingHandler = (*samplingHandler)(nil)
+
+func (h *samplingHandler) CreateMessage(ctx context.Context, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	slog.InfoContext(ctx, "sampling requested", slog.String("server", h.server), slog.Int("maxTokens", request.MaxTokens))
+	limit := h.config.TokenLimit()
+	if request.MaxTokens > limit {
+		return nil, errors.New(fmt.Sprintf("maxTokens %d exceeds the limit %d", request.MaxTokens, limit))
+	}
+	// the generation is capped by the limit of the server if the request does not ask for any
+	if request.MaxTokens <= 0 {
+		request.MaxTokens = limit
+	}
+	sampler := h.handlers.getSampler()
+	if sampler == nil {
+		return nil, errors.New("sampling is not available")
+	}
+	return sampler.CreateMessage(ctx, h.client(), h.server, h.config.Approval, request)
+}
@@ -0,0 +1,599 @@
+package mcpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcphost/pkg/llm"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/miyamo2/slackbot-mcp-host/internal/toolname"
+)
+
+// State is the state of a supervised MCP server.
+type State string
+
+const (
+	// StateStarting means the server is starting for the first time, or retrying to start in background.
+	StateStarting State = "starting"
+	// StateReady means the server is connected and initialized.
+	StateReady State = "ready"
+	// StateDegraded means the connection to the server is lost and it is restarting.
+	StateDegraded State = "degraded"
+	// StateFailed means the server failed to start or restart repeatedly. it is still retried at the maximum interval.
+	StateFailed State = "failed"
+)
+
+const (
+	// minRestartDelay is the delay before the first restart after the connection is lost.
+	minRestartDelay = 1 * time.Second
+	// maxRestartDelay is the maximum delay between restarts.
+	maxRestartDelay = 5 * time.Minute
+	// maxRestartAttempts is the number of consecutive failed restarts until the server is considered failed.
+	maxRestartAttempts = 10
+	// stableAfter is how long the server must keep running to reset the delay of restarts,
+	// not to restart a server crashing right after starting too often.
+	stableAfter = 1 * time.Minute
+	// healthCheckInterval is the interval to ping the server to detect the lost connection.
+	healthCheckInterval = 30 * time.Second
+	// healthCheckTimeout is the timeout for a ping to the server.
+	healthCheckTimeout = 10 * time.Second
+	// listToolsTimeout is the timeout to list the tools changed on the notification.
+	listToolsTimeout = 30 * time.Second
+)
+
+// ErrUnavailable is returned when the server is not ready.
+var ErrUnavailable = errors.New("mcp server is unavailable")
+
+// connectFunc creates and initializes an MCP client.
+type connectFunc func(ctx context.Context) (client.MCPClient, error)
+
+var _ client.MCPClient = (*Supervisor)(nil)
+
+// Supervisor is client.MCPClient that keeps the connection to an MCP server.
+// it detects the exited process or the lost connection, and restarts the server with backoff.
+type Supervisor struct {
+	name    string
+	connect connectFunc
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu        sync.RWMutex
+	client    client.MCPClient
+	listed    toolList
+	state     State
+	lastErr   error
+	startedAt time.Time
+	delay     time.Duration
+	closed    bool
+	// notificationHandlers are registered to every client after restart.
+	notificationHandlers []func(notification mcp.JSONRPCNotification)
+	// refreshMu serializes listing the tools on the notifications, not to overwrite newer tools with older ones.
+	refreshMu sync.Mutex
+	// roots advertises the roots of the channel of each tool call to the server. nil if not configured.
+	roots *rootsHandler
+	// names names the tools sent to the LLM.
+	names *toolname.Registry
+	// toolsConfig filters and renames the tools offered to the LLM. all tools are offered if nil.
+	toolsConfig *config.ToolsConfig
+}
+
+// toolList is the tools listed from the server.
+type toolList struct {
+	// tools are the tools offered to the LLM, named as the server names them.
+	tools []llm.Tool
+	// resources are the names of the synthetic tools to list and read the resources, handled by the supervisor itself.
+	resources map[string]bool
+	// approvals are the names of the tools whose calls must be approved by the user.
+	approvals map[string]bool
+}
+
+// newSupervisor returns Supervisor to keep the connection to the server. the server is not started yet.
+//
+//   - names: The registry naming the tools sent to the LLM.
+//   - tools: The configuration filtering and renaming the tools offered to the LLM. nil to offer all tools.
+//   - roots: The handler of the roots passed to the clients by connect. nil if not configured.
+func newSupervisor(rootCtx context.Context, name string, names *toolname.Registry, tools *config.ToolsConfig, roots *rootsHandler, connect connectFunc) *Supervisor {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(rootCtx))
+	return &Supervisor{
+		name:        name,
+		connect:     connect,
+		names:       names,
+		toolsConfig: tools,
+		roots:       roots,
+		ctx:         ctx,
+		cancel:      cancel,
+		state:       StateStarting,
+		delay:       minRestartDelay,
+	}
+}
+
+// Start starts the server and blocks until it is ready.
+// returns error if the server fails to start. the supervisor must be closed in that case.
+func (s *Supervisor) Start(ctx context.Context) error {
+	c, listed, err := s.start(ctx)
+	if err != nil {
+		s.mu.Lock()
+		s.lastErr = err
+		s.mu.Unlock()
+		return err
+	}
+	s.setReady(c, listed)
+	go s.healthCheck()
+	return nil
+}
+
+// StartBackground starts the server in background, and retries with backoff until it is ready.
+func (s *Supervisor) StartBackground() {
+	go s.healthCheck()
+	go s.restart(false)
+}
+
+// start connects to the server and lists its tools.
+func (s *Supervisor) start(ctx context.Context) (client.MCPClient, toolList, error) {
+	c, err := s.connect(ctx)
+	if err != nil {
+		return nil, toolList{}, err
+	}
+	listed, err := s.listTools(ctx, c)
+	if err != nil {
+		c.Close()
+		return nil, toolList{}, err
+	}
+	return c, listed, nil
+}
+
+// listTools lists the tools of the server with c, adding the synthetic tools for the resources if the server offers them.
+// the tools not allowed by the configuration are left out, and the descriptions are overridden as configured.
+func (s *Supervisor) listTools(ctx context.Context, c client.MCPClient) (toolList, error) {
+	tools, destructive, err := ListTools(ctx, c, s.name)
+	if err != nil {
+		return toolList{}, err
+	}
+	var resources map[string]bool
+	if supportsResources(c) {
+		resources = make(map[string]bool)
+		for _, tool := range resourceToolsOf(s.name, tools) {
+			tools = append(tools, tool)
+			resources[tool.Name] = true
+		}
+	}
+	listed := toolList{
+		tools:     make([]llm.Tool, 0, len(tools)),
+		resources: resources,
+		approvals: make(map[string]bool),
+	}
+	for _, tool := range tools {
+		if !s.toolsConfig.Allows(tool.Name) {
+			continue
+		}
+		if description := s.toolsConfig.Override(tool.Name).Description; description != "" {
+			tool.Description = description
+		}
+		listed.tools = append(listed.tools, tool)
+		if s.toolsConfig.RequiresApproval(tool.Name, destructive[tool.Name]) {
+			listed.approvals[tool.Name] = true
+		}
+	}
+	return listed, nil
+}
+
+// setReady makes c the current client. returns false if the supervisor is closed.
+func (s *Supervisor) setReady(c client.MCPClient, listed toolList) (toolsChanged bool, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		c.Close()
+		return false, false
+	}
+	toolsChanged = s.state != StateStarting && !reflect.DeepEqual(s.listed.tools, listed.tools)
+	s.client = c
+	s.listed = listed
+	s.names.Hold(s, s.toolKeys(listed))
+	s.state = StateReady
+	s.lastErr = nil
+	s.startedAt = time.Now()
+	c.OnNotification(func(notification mcp.JSONRPCNotification) {
+		if notification.Method == mcp.MethodNotificationToolsListChanged {
+			// the handler is called on the goroutine reading the responses, so ListTools must not block it
+			go s.refreshTools(c)
+		}
+	})
+	for _, handler := range s.notificationHandlers {
+		c.OnNotification(handler)
+	}
+	if c, ok := c.(*client.Client); ok {
+		c.OnConnectionLost(func(err error) {
+			s.fail(c, err)
+		})
+	}
+	return toolsChanged, true
+}
+
+// State returns the state of the server, and the last error if it is not ready.
+func (s *Supervisor) State() (State, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state, s.lastErr
+}
+
+// Tools returns the tools of the server listed on the last start, or on the last notification that they are changed.
+// the tools are named as sent to the LLM.
+func (s *Supervisor) Tools() []llm.Tool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tools := make([]llm.Tool, 0, len(s.listed.tools))
+	for _, tool := range s.listed.tools {
+		tool.Name = s.names.Name(s.toolKey(tool.Name))
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+// toolKey returns the tool named for the LLM.
+//
+//   - tool: The name of the tool on the server, not the alias.
+func (s *Supervisor) toolKey(tool string) toolname.Tool {
+	return toolname.Tool{Server: s.name, Name: tool, Alias: s.toolsConfig.Override(tool).Alias}
+}
+
+// toolKeys returns the tools of listed named for the LLM.
+func (s *Supervisor) toolKeys(listed toolList) []toolname.Tool {
+	keys := make([]toolname.Tool, 0, len(listed.tools))
+	for _, tool := range listed.tools {
+		keys = append(keys, s.toolKey(tool.Name))
+	}
+	return keys
+}
+
+// Allows reports whether the tool is offered to the LLM by the configuration.
+//
+//   - tool: The name of the tool on the server, not the alias.
+func (s *Supervisor) Allows(tool string) bool {
+	return s.toolsConfig.Allows(tool)
+}
+
+// RequiresApproval reports whether the calls of the tool must be approved by the user,
+// as configured or annotated as destructive by the server on the last listing.
+//
+//   - tool: The name of the tool on the server, not the alias.
+func (s *Supervisor) RequiresApproval(tool string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.listed.approvals[tool]
+}
+
+// current returns the current client, or ErrUnavailable if the server is not ready.
+func (s *Supervisor) current() (client.MCPClient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.client == nil {
+		if s.lastErr != nil {
+			return nil, fmt.Errorf("%w: %s is %s: %v", ErrUnavailable, s.name, s.state, s.lastErr)
+		}
+		return nil, fmt.Errorf("%w: %s is %s", ErrUnavailable, s.name, s.state)
+	}
+	return s.client, nil
+}
+
+// check inspects the error returned by c, and restarts the server if the connection is lost.
+func (s *Supervisor) check(c client.MCPClient, err error) {
+	var transportErr *transport.Error
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		// errors returned by the server itself
+		!errors.As(err, &transportErr):
+		return
+	case errors.Is(err, transport.ErrTransportClosed),
+		errors.Is(err, transport.ErrSessionTerminated):
+		s.fail(c, err)
+	default:
+		// the failure may be temporary. confirm the connection is lost.
+		go s.ping(c)
+	}
+}
+
+// ping pings the server with c, and restarts the server if the connection is lost.
+func (s *Supervisor) ping(c client.MCPClient) {
+	ctx, cancel := context.WithTimeout(s.ctx, healthCheckTimeout)
+	defer cancel()
+	err := c.Ping(ctx)
+	var transportErr *transport.Error
+	if err != nil && errors.As(err, &transportErr) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		s.fail(c, err)
+	}
+}
+
+// healthCheck pings the server periodically, to restart the server whose connection is lost while idle.
+func (s *Supervisor) healthCheck() {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.mu.RLock()
+		c := s.client
+		s.mu.RUnlock()
+		if c != nil {
+			s.ping(c)
+		}
+	}
+}
+
+// fail discards c as its connection is lost, and restarts the server in background.
+func (s *Supervisor) fail(c client.MCPClient, err error) {
+	s.mu.Lock()
+	if s.closed || s.client != c {
+		// already restarting or closed
+		s.mu.Unlock()
+		return
+	}
+	if time.Since(s.startedAt) >= stableAfter {
+		s.delay = minRestartDelay
+	}
+	s.client = nil
+	s.state = StateDegraded
+	s.lastErr = err
+	s.mu.Unlock()
+
+	slog.WarnContext(s.ctx, "lost connection to mcp server. restarting",
+		slog.String("name", s.name),
+		slog.String("error", err.Error()))
+	go c.Close()
+	go s.restart(true)
+}
+
+// restart (re)starts the server with exponential backoff until it succeeds or the supervisor is closed.
+//
+//   - wait: Whether to wait before the first attempt.
+func (s *Supervisor) restart(wait bool) {
+	for attempt := 1; ; attempt++ {
+		if wait || attempt > 1 {
+			s.mu.Lock()
+			delay := s.delay
+			s.delay = min(s.delay*2, maxRestartDelay)
+			s.mu.Unlock()
+			// add jitter not to restart the servers sharing a cause at once
+			delay += rand.N(delay / 4)
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+
+		slog.InfoContext(s.ctx, "start mcp server", slog.String("name", s.name), slog.Int("attempt", attempt))
+		c, listed, err := s.start(s.ctx)
+		if err == nil {
+			toolsChanged, ok := s.setReady(c, listed)
+			if !ok {
+				return
+			}
+			slog.InfoContext(s.ctx, "mcp server started", slog.String("name", s.name), slog.Int("attempt", attempt))
+			if toolsChanged {
+				slog.InfoContext(s.ctx, "tools of mcp server changed", slog.String("name", s.name), slog.Any("tools", listed.tools))
+			}
+			return
+		}
+
+		s.mu.Lock()
+		s.lastErr = err
+		if attempt >= maxRestartAttempts {
+			s.state = StateFailed
+		}
+		state := s.state
+		s.mu.Unlock()
+		slog.ErrorContext(s.ctx, "failed to start mcp server",
+			slog.String("name", s.name),
+			slog.Int("attempt", attempt),
+			slog.String("state", string(state)),
+			slog.String("error", err.Error()))
+	}
+}
+
+// refreshTools lists the tools of the server again with c, as the server notified that they are changed.
+func (s *Supervisor) refreshTools(c client.MCPClient) {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	ctx, cancel := context.WithTimeout(s.ctx, listToolsTimeout)
+	defer cancel()
+	listed, err := s.listTools(ctx, c)
+	if err != nil {
+		slog.WarnContext(s.ctx, "failed to list changed tools of mcp server",
+			slog.String("name", s.name),
+			slog.String("error", err.Error()))
+		s.check(c, err)
+		return
+	}
+	s.mu.Lock()
+	if s.client != c {
+		// restarted or closed. the tools are listed on restart.
+		s.mu.Unlock()
+		return
+	}
+	toolsChanged := !reflect.DeepEqual(s.listed.tools, listed.tools)
+	s.listed = listed
+	s.names.Hold(s, s.toolKeys(listed))
+	s.mu.Unlock()
+	if toolsChanged {
+		slog.InfoContext(s.ctx, "tools of mcp server changed", slog.String("name", s.name), slog.Any("tools", listed.tools))
+	}
+}
+
+// Close stops supervising and closes the current client.
+// the names of its tools are forgotten unless other servers offer them, so it must be closed after the sessions using them finish.
+func (s *Supervisor) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.cancel()
+	s.names.Release(s)
+	if s.client == nil {
+		return nil
+	}
+	c := s.client
+	s.client = nil
+	return c.Close()
+}
+
+// OnNotification registers the handler to the current client, and to the clients after restart.
+func (s *Supervisor) OnNotification(handler func(notification mcp.JSONRPCNotification)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notificationHandlers = append(s.notificationHandlers, handler)
+	if s.client != nil {
+		s.client.OnNotification(handler)
+	}
+}
+
+// supervise calls f with the current client, and restarts the server if the connection is lost.
+func supervise[T any](s *Supervisor, f func(c client.MCPClient) (T, error)) (T, error) {
+	c, err := s.current()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	v, err := f(c)
+	s.check(c, err)
+	return v, err
+}
+
+// superviseErr is supervise for the methods returning only error.
+func superviseErr(s *Supervisor, f func(c client.MCPClient) error) error {
+	_, err := supervise(s, func(c client.MCPClient) (struct{}, error) {
+		return struct{}{}, f(c)
+	})
+	return err
+}
+
+func (s *Supervisor) Initialize(ctx context.Context, request mcp.InitializeRequest) (*mcp.InitializeResult, error) {
+	return supervise(s, func(c client.MCPClient) (*mcp.InitializeResult, error) {
+		return c.Initialize(ctx, request)
+	})
+}
+
+func (s *Supervisor) Ping(ctx context.Context) error {
+	return superviseErr(s, func(c client.MCPClient) error {
+		return c.Ping(ctx)
+	})
+}
+
+func (s *Supervisor) ListResourcesByPage(ctx context.Context, request mcp.ListResourcesRequest) (*mcp.ListResourcesResult, error) {
+	return supervise(s, func(c client.MCPClient) (*mcp.ListResourcesResult, error) {
+		return c.ListResourcesByPage(ctx, request)
+	})
+}
+
+func (s *Supervisor) ListResources(ctx context.Context, request mcp.ListResourcesRequest) (*mcp.ListResourcesResult, error) {
+	return supervise(s, func(c client.MCPClient) (*mcp.ListResourcesResult, error) {
+		return c.ListResources(ctx, request)
+	})
+}
+
+func (s *Supervisor) ListResourceTemplatesByPage(ctx context.Context, request mcp.ListResourceTemplatesRequest) (*mcp.ListResourceTemplatesResult, error) {
+	return supervise(s, func(c client.MCPClient) (*mcp.ListResourceTemplatesResult, error) {
+		return c.ListResourceTemplatesByPage(ctx, request)
+	})
+}
+
+func (s *Supervisor) ListResourceTemplates(ctx context.Context, request mcp.ListResourceTemplatesRequest) (*mcp.ListResourceTemplatesResult, error) {
+	return supervise(s, func(c client.MCPClient) (*mcp.ListResourceTemplatesResult, error) {
+		return c.ListResourceTemplates(ctx, request)
+	})
+}
+
+func (s *Supervisor) ReadResource(ctx context.Context, request mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	return supervise(s, func(c client.MCPClient) (*mcp.ReadResourceResult, error) {
+		return c.ReadResource(ctx, request)
+	})
+}
+
+func (s *Supervisor) Subscribe(ctx context.Context, request mcp.SubscribeRequest) error {
+	return superviseErr(s, func(c client.MCPClient) error {
+		return c.Subscribe(ctx, request)
+	})
+}
+
+func (s *Supervisor) Unsubscribe(ctx context.Context, request mcp.UnsubscribeRequest) error {
+	return superviseErr(s, func(c client.MCPClient) error {
+		return c.Unsubscribe(ctx, request)
+	})
+}
+
+func (s *Supervisor) ListPromptsByPage(ctx context.Context, request mcp.ListPromptsRequest) (*mcp.ListPromptsResult, error) {
+	return supervise(s, func(c client.MCPClient) (*mcp.ListPromptsResult, error) {
+		return c.ListPromptsByPage(ctx, request)
+	})
+}
+
+func (s *Supervisor) ListPrompts(ctx context.Context, request mcp.ListPromptsRequest) (*mcp.ListPromptsResult, error) {
+	return supervise(s, func(c client.MCPClient) (*mcp.ListPromptsResult, error) {
+		return c.ListPrompts(ctx, request)
+	})
+}
+
+func (s *Supervisor) GetPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	return supervise(s, func(c client.MCPClient) (*mcp.GetPromptResult, error) {
+		return c.GetPrompt(ctx, request)
+	})
+}
+
+func (s *Supervisor) ListToolsByPage(ctx context.Context, request mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	return supervise(s, func(c client.MCPClient) (*mcp.ListToolsResult, error) {
+		return c.ListToolsByPage(ctx, request)
+	})
+}
+
+func (s *Supervisor) ListTools(ctx context.Context, request mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	return supervise(s, func(c client.MCPClient) (*mcp.ListToolsResult, error) {
+		return c.ListTools(ctx, request)
+	})
+}
+
+// CallTool calls the tool of the server, or the synthetic tool for the resources.
+func (s *Supervisor) CallTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	s.mu.RLock()
+	resourceTool := s.listed.resources[request.Params.Name]
+	s.mu.RUnlock()
+	return supervise(s, func(c client.MCPClient) (*mcp.CallToolResult, error) {
+		if s.roots != nil {
+			exit, err := s.roots.enter(ctx, c, request)
+			if err != nil {
+				return nil, err
+			}
+			defer exit()
+		}
+		if resourceTool {
+			return callResourceTool(ctx, c, s.name, request)
+		}
+		return c.CallTool(ctx, request)
+	})
+}
+
+func (s *Supervisor) SetLevel(ctx context.Context, request mcp.SetLevelRequest) error {
+	return superviseErr(s, func(c client.MCPClient) error {
+		return c.SetLevel(ctx, request)
+	})
+}
+
+func (s *Supervisor) Complete(ctx context.Context, request mcp.CompleteRequest) (*mcp.CompleteResult, error) {
+	return supervise(s, func(c client.MCPClient) (*mcp.CompleteResult, error) {
+		return c.Complete(ctx, request)
+	})
+}
@@ -0,0 +1,230 @@
+package mcpclient
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/miyamo2/slackbot-mcp-host/internal/toolname"
+)
+
+// newTestMCPServer returns the MCP server with the echo tool.
+func newTestMCPServer() *mcpserver.MCPServer {
+	s := mcpserver.NewMCPServer("test", "1.0.0", mcpserver.WithToolCapabilities(true))
+	s.AddTool(mcp.NewTool("echo", mcp.WithString("text")), echoTool)
+	return s
+}
+
+func echoTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return mcp.NewToolResultText("echo:" + request.GetString("text", "")), nil
+}
+
+// flakyConnect connects to the in-process server after failing the given number of times.
+type flakyConnect struct {
+	server *mcpserver.MCPServer
+	mu     sync.Mutex
+	// failures is the number of the attempts left to fail. negative to fail forever.
+	failures int
+	attempts int
+}
+
+func (f *flakyConnect) connect(ctx context.Context) (client.MCPClient, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts++
+	if f.failures != 0 {
+		f.failures--
+		return nil, errors.New("connection refused")
+	}
+	c, err := client.NewInProcessClient(f.server)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(ctx); err != nil {
+		return nil, err
+	}
+	request := mcp.InitializeRequest{}
+	request.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	if _, err := c.Initialize(ctx, request); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (f *flakyConnect) attemptsSoFar() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.attempts
+}
+
+// newTestSupervisor returns the supervisor connecting with connect, restarting without waiting long.
+func newTestSupervisor(t *testing.T, connect connectFunc, delay time.Duration) *Supervisor {
+	t.Helper()
+	s := newSupervisor(context.Background(), "test", toolname.NewRegistry(toolname.RuleOf(config.LLMProviderAnthropic)), nil, nil, connect)
+	s.delay = delay
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// restartDelay returns the delay before the next restart of the supervisor.
+func restartDelay(s *Supervisor) time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.delay
+}
+
+// waitFor waits until cond is true, or fails the test after a while.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// stateIs returns the condition that the state of the supervisor is want.
+func stateIs(s *Supervisor, want State) func() bool {
+	return func() bool {
+		state, _ := s.State()
+		return state == want
+	}
+}
+
+// toolNames returns the names of the tools of the supervisor.
+func toolNames(s *Supervisor) []string {
+	var names []string
+	for _, tool := range s.Tools() {
+		names = append(names, tool.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestSupervisor_StartBackground_Backoff(t *testing.T) {
+	connect := &flakyConnect{server: newTestMCPServer(), failures: 3}
+	s := newTestSupervisor(t, connect.connect, time.Millisecond)
+	if state, _ := s.State(); state != StateStarting {
+		t.Fatalf("State() = %s, want %s before starting", state, StateStarting)
+	}
+
+	s.StartBackground()
+	waitFor(t, "ready", stateIs(s, StateReady))
+
+	if got := connect.attemptsSoFar(); got != 4 {
+		t.Errorf("attempts = %d, want 4", got)
+	}
+	// the delay doubles on each retry after the first attempt: 1ms, 2ms, 4ms
+	if got := restartDelay(s); got != 8*time.Millisecond {
+		t.Errorf("delay = %v, want %v", got, 8*time.Millisecond)
+	}
+	if _, err := s.State(); err != nil {
+		t.Errorf("State() error = %v, want nil when ready", err)
+	}
+	if got := toolNames(s); !slices.Equal(got, []string{"test__echo"}) {
+		t.Errorf("Tools() = %v, want [test__echo]", got)
+	}
+}
+
+func TestSupervisor_StartBackground_Failed(t *testing.T) {
+	connect := &flakyConnect{server: newTestMCPServer(), failures: -1}
+	s := newTestSupervisor(t, connect.connect, time.Microsecond)
+
+	s.StartBackground()
+	waitFor(t, "failed", stateIs(s, StateFailed))
+
+	if got := connect.attemptsSoFar(); got < maxRestartAttempts {
+		t.Errorf("attempts = %d, want %d at least", got, maxRestartAttempts)
+	}
+	if _, err := s.State(); err == nil {
+		t.Error("State() error = nil, want the last error")
+	}
+	if _, err := s.CallTool(context.Background(), mcp.CallToolRequest{}); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("CallTool() error = %v, want %v", err, ErrUnavailable)
+	}
+}
+
+func TestSupervisor_Restart(t *testing.T) {
+	connect := &flakyConnect{server: newTestMCPServer()}
+	s := newTestSupervisor(t, connect.connect, time.Millisecond)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if state, _ := s.State(); state != StateReady {
+		t.Fatalf("State() = %s, want %s", state, StateReady)
+	}
+	c, _ := s.current()
+
+	connect.mu.Lock()
+	connect.failures = 1
+	connect.mu.Unlock()
+	s.fail(c, errors.New("connection lost"))
+	if state, err := s.State(); state != StateDegraded || err == nil {
+		t.Errorf("State() = %s, %v, want %s with the error", state, err, StateDegraded)
+	}
+	// the connection lost again is ignored while restarting
+	s.fail(c, errors.New("connection lost"))
+
+	waitFor(t, "restarted", stateIs(s, StateReady))
+	if got := connect.attemptsSoFar(); got != 3 {
+		t.Errorf("attempts = %d, want 3", got)
+	}
+	// the delay is not reset as the server crashed right after starting
+	if got := restartDelay(s); got != 4*time.Millisecond {
+		t.Errorf("delay = %v, want %v", got, 4*time.Millisecond)
+	}
+	if restarted, _ := s.current(); restarted == c {
+		t.Error("current() is the lost client after restart")
+	}
+
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "echo"
+	request.Params.Arguments = map[string]any{"text": "hello"}
+	result, err := s.CallTool(context.Background(), request)
+	if err != nil {
+		t.Fatalf("CallTool() error = %v", err)
+	}
+	if text, ok := result.Content[0].(mcp.TextContent); !ok || text.Text != "echo:hello" {
+		t.Errorf("CallTool() content = %+v, want echo:hello", result.Content)
+	}
+
+	s.Close()
+	if _, err := s.current(); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("current() error = %v, want %v after Close", err, ErrUnavailable)
+	}
+}
+
+func TestSupervisor_ToolsListChanged(t *testing.T) {
+	server := newTestMCPServer()
+	ts := httptest.NewServer(mcpserver.NewStreamableHTTPServer(server))
+	t.Cleanup(ts.Close)
+	cfg := config.MCPServerConfig{Type: config.TransportStreamableHTTP, URL: ts.URL, Listen: true}
+	s := newTestSupervisor(t, func(ctx context.Context) (client.MCPClient, error) {
+		return New(ctx, "test", cfg)
+	}, time.Millisecond)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	server.AddTool(mcp.NewTool("reverse", mcp.WithString("text")), echoTool)
+	waitFor(t, "tools refreshed", func() bool { return len(s.Tools()) == 2 })
+	if got := toolNames(s); !slices.Equal(got, []string{"test__echo", "test__reverse"}) {
+		t.Errorf("Tools() = %v, want [test__echo test__reverse]", got)
+	}
+
+	server.DeleteTools("echo")
+	waitFor(t, "tools refreshed", func() bool { return len(s.Tools()) == 1 })
+	if _, _, ok := s.names.Resolve("test__echo"); ok {
+		t.Error("Resolve() of deleted tool = true, want false")
+	}
+}
@@ -0,0 +1,403 @@
+package mcpclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcphost/pkg/llm"
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+	"github.com/miyamo2/slackbot-mcp-host/internal/toolname"
+)
+
+const (
+	// CallbackPath is the path of the endpoint to receive the authorization code on linking an account.
+	CallbackPath = "/oauth/callback"
+	// linkExpiresIn is how long a link to link an account is valid.
+	linkExpiresIn = 10 * time.Minute
+	// userIdleTimeout is how long a per-user server is kept running without being used. it must be longer than the sessions.
+	userIdleTimeout = 30 * time.Minute
+	// idleCheckInterval is the interval to stop the idle per-user servers.
+	idleCheckInterval = time.Minute
+)
+
+var (
+	// ErrLinkExpired is returned when the link to link an account is unknown or expired.
+	ErrLinkExpired = errors.New("link is expired")
+	// ErrServerNotFound is returned when the per-user server is not configured.
+	ErrServerNotFound = errors.New("server not found")
+)
+
+// UserPool holds the MCP clients of the per-user servers, connected for each Slack user with the user's own account.
+// the accounts are linked with OAuth authorization_code grant, and the clients are started on the first use.
+// the clients not used for userIdleTimeout are stopped, and started again on the next use.
+type UserPool struct {
+	redirectURI string
+	idleTimeout time.Duration
+	// cancel stops watching the idle servers.
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	configs map[string]config.MCPServerConfig
+	// users is the connections to the per-user servers keyed by userKey.
+	users map[string]*userServer
+	// links is the pending links keyed by state.
+	links    map[string]*link
+	handlers handlers
+	names    *toolname.Registry
+}
+
+// userServer represents the connection to a per-user server for a user.
+type userServer struct {
+	name     string
+	config   config.MCPServerConfig
+	tokens   *tokenSource
+	handlers *handlers
+	names    *toolname.Registry
+	// mu serializes starting the server.
+	mu         sync.Mutex
+	supervisor *Supervisor
+	// lastUsed is the time the server is last used by the sessions.
+	lastUsed time.Time
+	// closed is true if the server is removed or changed.
+	closed bool
+}
+
+// link is a pending request to link an account.
+type link struct {
+	user      *userServer
+	userID    string
+	verifier  string
+	expiresAt time.Time
+}
+
+// NewUserPool returns a new instance of UserPool.
+//
+//   - publicURL: The URL of the bot reachable from the browsers of the users.
+//
+//   - names: The registry naming the tools sent to the LLM.
+func NewUserPool(publicURL string, names *toolname.Registry) *UserPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &UserPool{
+		redirectURI: strings.TrimSuffix(publicURL, "/") + CallbackPath,
+		idleTimeout: userIdleTimeout,
+		cancel:      cancel,
+		names:       names,
+		configs:     make(map[string]config.MCPServerConfig),
+		users:       make(map[string]*userServer),
+		links:       make(map[string]*link),
+	}
+	go p.watchIdle(ctx)
+	return p
+}
+
+// watchIdle stops the idle servers periodically until ctx is done.
+func (p *UserPool) watchIdle(ctx context.Context) {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.stopIdle(now)
+		}
+	}
+}
+
+// stopIdle stops the servers not used since p.idleTimeout before now.
+// the connections are kept with the linked accounts, so that the servers are started again on the next use.
+func (p *UserPool) stopIdle(now time.Time) {
+	p.mu.Lock()
+	users := slices.Collect(maps.Values(p.users))
+	p.mu.Unlock()
+	for _, u := range users {
+		supervisor := u.takeIdle(now.Add(-p.idleTimeout))
+		if supervisor == nil {
+			continue
+		}
+		slog.Info("stop idle per-user mcp server", slog.String("name", u.name))
+		if err := supervisor.Close(); err != nil {
+			slog.Warn("failed to close mcp client", slog.String("name", u.name), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// userKey returns the key of the connection to the server for the user.
+func userKey(name, userID string) string {
+	return fmt.Sprintf("%s#%s", name, userID)
+}
+
+// Apply replaces the configuration of the per-user servers. servers that are not per-user are ignored.
+//
+// The clients of the removed or changed servers are returned instead of being closed,
+// so that sessions still using them can finish. The caller must close them.
+func (p *UserPool) Apply(ctx context.Context, servers map[string]config.MCPServerConfig) (stale []client.MCPClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	configs := make(map[string]config.MCPServerConfig)
+	for name, cfg := range servers {
+		if cfg.PerUser {
+			configs[name] = cfg
+		}
+	}
+	for key, u := range p.users {
+		if cfg, ok := configs[u.name]; ok && reflect.DeepEqual(cfg, u.config) {
+			continue
+		}
+		u.mu.Lock()
+		u.closed = true
+		if u.supervisor != nil {
+			stale = append(stale, u.supervisor)
+		}
+		u.mu.Unlock()
+		delete(p.users, key)
+	}
+	for state, l := range p.links {
+		if p.users[userKey(l.user.name, l.userID)] != l.user {
+			delete(p.links, state)
+		}
+	}
+	for name := range configs {
+		if _, ok := p.configs[name]; !ok {
+			slog.InfoContext(ctx, "add per-user mcp server", slog.String("name", name))
+		}
+	}
+	p.configs = configs
+	return stale
+}
+
+// Clients returns the clients and tools of the per-user servers for the user, starting them if necessary.
+// the names of the servers the user has not linked the account yet are returned as unlinked.
+func (p *UserPool) Clients(ctx context.Context, userID string) (clients map[string]client.MCPClient, tools []llm.Tool, unlinked []string) {
+	clients = make(map[string]client.MCPClient)
+	for _, u := range p.usersOf(userID) {
+		s, err := u.start(ctx)
+		switch {
+		case errors.Is(err, ErrNotLinked):
+			unlinked = append(unlinked, u.name)
+		case err != nil:
+			slog.ErrorContext(ctx, "failed to start per-user mcp server",
+				slog.String("name", u.name),
+				slog.String("user", userID),
+				slog.String("error", err.Error()))
+		default:
+			clients[u.name] = s
+			tools = slices.Concat(tools, s.Tools())
+		}
+	}
+	slices.Sort(unlinked)
+	return clients, tools, unlinked
+}
+
+// usersOf returns the connections to all per-user servers for the user.
+func (p *UserPool) usersOf(userID string) []*userServer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	users := make([]*userServer, 0, len(p.configs))
+	for name, cfg := range p.configs {
+		u, err := p.userServer(name, userID, cfg)
+		if err != nil {
+			slog.Error("failed to prepare per-user mcp server",
+				slog.String("name", name),
+				slog.String("user", userID),
+				slog.String("error", err.Error()))
+			continue
+		}
+		users = append(users, u)
+	}
+	return users
+}
+
+// userServer returns the connection to the server for the user. p.mu must be held.
+func (p *UserPool) userServer(name, userID string, cfg config.MCPServerConfig) (*userServer, error) {
+	key := userKey(name, userID)
+	if u, ok := p.users[key]; ok {
+		return u, nil
+	}
+	t, err := newTLSTransport(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	var store transport.TokenStore = transport.NewMemoryTokenStore()
+	if cfg.OAuth.TokenDir != "" {
+		store = &fileTokenStore{path: filepath.Join(cfg.OAuth.TokenDir, userID+".json")}
+	}
+	u := &userServer{
+		name:     name,
+		config:   cfg,
+		tokens:   newTokenSource(&http.Client{Transport: t}, name, cfg.URL, *cfg.OAuth, store),
+		handlers: &p.handlers,
+		names:    p.names,
+	}
+	p.users[key] = u
+	return u, nil
+}
+
+// start returns the running server, starting it if the account is linked.
+// returns ErrNotLinked if the account is not linked.
+func (u *userServer) start(ctx context.Context) (*Supervisor, error) {
+	if _, err := u.tokens.token(ctx); err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, u.name)
+	}
+	u.lastUsed = time.Now()
+	if u.supervisor != nil {
+		return u.supervisor, nil
+	}
+	var supervisor *Supervisor
+	attributed := func() client.MCPClient { return supervisor }
+	roots := newRootsHandler(u.name, u.config, u.handlers, attributed)
+	supervisor = newSupervisor(ctx, u.name, u.names, u.config.Tools, roots, func(ctx context.Context) (client.MCPClient, error) {
+		return newClient(ctx, u.name, u.config, u.tokens, clientOptions(u.name, u.config, u.handlers, roots, attributed)...)
+	})
+	supervisor.OnNotification(observe(u.name, u.handlers, supervisor))
+	if err := supervisor.Start(ctx); err != nil {
+		supervisor.Close()
+		return nil, err
+	}
+	u.supervisor = supervisor
+	return supervisor, nil
+}
+
+// takeIdle detaches the running server if it is not used since the time, and returns it to be closed.
+// returns nil if the server is not running or used since then.
+func (u *userServer) takeIdle(since time.Time) *Supervisor {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.supervisor == nil || u.lastUsed.After(since) {
+		return nil
+	}
+	supervisor := u.supervisor
+	u.supervisor = nil
+	return supervisor
+}
+
+// LinkURL returns the URL for the user to link the account of the server, and the time it expires.
+func (p *UserPool) LinkURL(ctx context.Context, name, userID string) (string, time.Time, error) {
+	p.mu.Lock()
+	cfg, ok := p.configs[name]
+	if !ok {
+		p.mu.Unlock()
+		return "", time.Time{}, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	u, err := p.userServer(name, userID, cfg)
+	if err == nil {
+		for state, l := range p.links {
+			if time.Now().After(l.expiresAt) {
+				delete(p.links, state)
+			}
+		}
+	}
+	p.mu.Unlock()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	authorizationURL, err := u.tokens.authorizationURL(ctx, state, verifier, p.redirectURI)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	expiresAt := time.Now().Add(linkExpiresIn)
+	p.links[state] = &link{
+		user:      u,
+		userID:    userID,
+		verifier:  verifier,
+		expiresAt: expiresAt,
+	}
+	return authorizationURL, expiresAt, nil
+}
+
+// Link completes linking the account with the authorization code issued for the link identified by state.
+// returns the name of the server and the Slack user ID of the linked account.
+func (p *UserPool) Link(ctx context.Context, state, code string) (name, userID string, err error) {
+	p.mu.Lock()
+	l, ok := p.links[state]
+	delete(p.links, state)
+	p.mu.Unlock()
+	if !ok || time.Now().After(l.expiresAt) {
+		return "", "", ErrLinkExpired
+	}
+	if err := l.user.tokens.exchangeCode(ctx, code, l.verifier, p.redirectURI); err != nil {
+		return "", "", err
+	}
+	slog.InfoContext(ctx, "linked account", slog.String("name", l.user.name), slog.String("user", l.userID))
+	return l.user.name, l.userID, nil
+}
+
+// SetSampler sets the sampler for the sampling requests from the servers.
+func (p *UserPool) SetSampler(sampler Sampler) {
+	p.handlers.setSampler(sampler)
+}
+
+// SetElicitor sets the elicitor for the elicitation requests from the servers.
+func (p *UserPool) SetElicitor(elicitor Elicitor) {
+	p.handlers.setElicitor(elicitor)
+}
+
+// SetObserver sets the observer for the notifications from the servers.
+func (p *UserPool) SetObserver(observer Observer) {
+	p.handlers.setObserver(observer)
+}
+
+// SetChannelResolver sets the resolver of the Slack channels the tool calls are made from.
+func (p *UserPool) SetChannelResolver(resolver ChannelResolver) {
+	p.handlers.setChannelResolver(resolver)
+}
+
+// Close stops all running servers.
+func (p *UserPool) Close() error {
+	p.cancel()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for key, u := range p.users {
+		u.mu.Lock()
+		u.closed = true
+		if u.supervisor != nil {
+			if err := u.supervisor.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to close mcp client: %s: %w", key, err))
+			}
+		}
+		u.mu.Unlock()
+		delete(p.users, key)
+	}
+	return errors.Join(errs...)
+}
+
+// randomString returns a random URL-safe string with 256 bits of entropy.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random string: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
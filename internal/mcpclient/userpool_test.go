@@ -0,0 +1,53 @@
+package mcpclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miyamo2/slackbot-mcp-host/internal/toolname"
+)
+
+func TestUserPool_StopIdle(t *testing.T) {
+	names := toolname.NewRegistry(toolname.RuleOf())
+	p := NewUserPool("https://bot.example.com", names)
+	defer p.Close()
+
+	now := time.Now()
+	newUser := func(name string, lastUsed time.Time) *userServer {
+		return &userServer{
+			name:       name,
+			names:      names,
+			supervisor: newSupervisor(context.Background(), name, names, nil, nil, nil),
+			lastUsed:   lastUsed,
+		}
+	}
+	idle := newUser("idle", now.Add(-p.idleTimeout-time.Second))
+	used := newUser("used", now.Add(-p.idleTimeout+time.Second))
+	stopped := &userServer{name: "stopped", names: names, lastUsed: now.Add(-2 * p.idleTimeout)}
+	idleSupervisor := idle.supervisor
+	p.users = map[string]*userServer{
+		userKey("idle", "U1"):    idle,
+		userKey("used", "U1"):    used,
+		userKey("stopped", "U1"): stopped,
+	}
+
+	p.stopIdle(now)
+
+	if idle.supervisor != nil {
+		t.Error("idle server is still running")
+	}
+	if !idleSupervisor.closed {
+		t.Error("supervisor of idle server is not closed")
+	}
+	if used.supervisor == nil || used.supervisor.closed {
+		t.Error("used server is stopped")
+	}
+	if stopped.supervisor != nil {
+		t.Error("stopped server is started")
+	}
+	// the connections are kept to start the servers again with the linked accounts
+	if len(p.users) != 3 {
+		t.Errorf("users = %d, want 3", len(p.users))
+	}
+}
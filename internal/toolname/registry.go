@@ -0,0 +1,184 @@
+package toolname
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// separator joins the names of the server and the tool.
+const separator = "__"
+
+// hashLength is the length of the hash appended to the names to make them unique.
+const hashLength = 8
+
+// Tool identifies the tool of an MCP server.
+type Tool struct {
+	Server string
+	Name   string
+	// Alias is the name of the tool shown to the LLM instead of Name. Name if empty.
+	Alias string
+}
+
+// shown returns the name of the tool shown to the LLM.
+func (t Tool) shown() string {
+	if t.Alias != "" {
+		return t.Alias
+	}
+	return t.Name
+}
+
+// Registry maps the tools of the MCP servers to the names sent to the LLM, and back.
+// the names are `<server>__<tool or alias>` sanitized by the rule of the provider, and made unique with a hash if they collide.
+// once assigned, a name is kept for the tool while it is held, so that it is stable during the sessions. safe for concurrent use.
+type Registry struct {
+	mu   sync.RWMutex
+	rule Rule
+	// names are the names of the tools under the current rule.
+	names map[Tool]string
+	// tools are the tools of the names, including the ones assigned under the previous rules.
+	tools map[string]Tool
+	// held are the tools held by each owner.
+	held map[any]map[Tool]bool
+	// holders are the numbers of the owners holding each tool.
+	holders map[Tool]int
+}
+
+// NewRegistry returns a new instance of Registry.
+//
+//   - rule: The rule of the names of the LLM provider.
+func NewRegistry(rule Rule) *Registry {
+	return &Registry{
+		rule:    rule,
+		names:   make(map[Tool]string),
+		tools:   make(map[string]Tool),
+		held:    make(map[any]map[Tool]bool),
+		holders: make(map[Tool]int),
+	}
+}
+
+// SetRule changes the rule of the names, such as when the LLM provider is changed.
+// the names are assigned again under the new rule, while the previous names are still resolved for the sessions in progress.
+func (r *Registry) SetRule(rule Rule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rule.Provider == rule.Provider {
+		return
+	}
+	r.rule = rule
+	r.names = make(map[Tool]string)
+}
+
+// Name returns the name of the tool sent to the LLM, assigning a new one if the tool is not named yet.
+func (r *Registry) Name(key Tool) string {
+	r.mu.RLock()
+	name, ok := r.names[key]
+	r.mu.RUnlock()
+	if ok {
+		return name
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name, ok := r.names[key]; ok {
+		return name
+	}
+	name = r.rule.sanitize(key)
+	// the names assigned under the previous rules are not reused for other tools either
+	if owner, ok := r.tools[name]; ok && owner != key {
+		slog.Warn("tool names collide. the hash is appended to the name",
+			slog.String("name", name),
+			slog.String("server", key.Server),
+			slog.String("tool", key.Name),
+			slog.String("other_server", owner.Server),
+			slog.String("other_tool", owner.Name))
+		// the name with the hash may also be taken, such as by the tool named so
+		suffixed := r.rule.withSuffix(name, hash(key))
+		for i := 2; ; i++ {
+			if owner, ok := r.tools[suffixed]; !ok || owner == key {
+				break
+			}
+			suffixed = r.rule.withSuffix(name, fmt.Sprintf("%s%d", hash(key), i))
+		}
+		name = suffixed
+	}
+	r.names[key] = name
+	r.tools[name] = key
+	return name
+}
+
+// Hold records the tools offered to the LLM by the owner, such as the supervisor of a server,
+// and forgets the names of the tools the owner no longer offers, unless other owners hold them.
+// the forgotten names are neither resolved nor assigned to the tools again, and may be assigned to other tools.
+func (r *Registry) Hold(owner any, tools []Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	held := make(map[Tool]bool, len(tools))
+	for _, key := range tools {
+		if !held[key] && !r.held[owner][key] {
+			r.holders[key]++
+		}
+		held[key] = true
+	}
+	for key := range r.held[owner] {
+		if !held[key] {
+			r.release(key)
+		}
+	}
+	if len(held) == 0 {
+		delete(r.held, owner)
+		return
+	}
+	r.held[owner] = held
+}
+
+// Release forgets the names of the tools held by the owner unless other owners hold them, such as when the server is stopped.
+// the owner must release the tools after the sessions using them finish.
+func (r *Registry) Release(owner any) {
+	r.Hold(owner, nil)
+}
+
+// release releases the tool held by an owner, and forgets its names if no owner holds it.
+func (r *Registry) release(key Tool) {
+	r.holders[key]--
+	if r.holders[key] > 0 {
+		return
+	}
+	delete(r.holders, key)
+	delete(r.names, key)
+	for name, tool := range r.tools {
+		if tool == key {
+			delete(r.tools, name)
+		}
+	}
+}
+
+// Resolve returns the server and the tool of the name sent to the LLM. the tool is the name on the server, not the alias.
+// returns false if the name is not assigned to any tool.
+func (r *Registry) Resolve(name string) (server, tool string, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.tools[name]
+	if !ok {
+		return "", "", false
+	}
+	return key.Server, key.Name, true
+}
+
+// hash returns the short hash identifying the tool.
+func hash(tool Tool) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s", tool.Server, tool.Name, tool.Alias)))
+	return hex.EncodeToString(sum[:])[:hashLength]
+}
+
+// withSuffix appends the suffix to the name, truncating the name to fit in the maximum length.
+func (r Rule) withSuffix(name, suffix string) string {
+	suffix = "_" + suffix
+	if len(name)+len(suffix) > r.MaxLength {
+		name = strings.TrimRight(name[:r.MaxLength-len(suffix)], "_")
+	}
+	return name + suffix
+}
@@ -0,0 +1,259 @@
+package toolname
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+)
+
+// anthropicName is the pattern of the tool names accepted by anthropic and openai.
+var anthropicName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// googleName is the pattern of the tool names accepted by google.
+var googleName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.:-]{0,63}$`)
+
+func TestRegistry_Name(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	tests := []struct {
+		name    string
+		rule    Rule
+		tool    Tool
+		want    string
+		pattern *regexp.Regexp
+	}{
+		{
+			name:    "plain",
+			rule:    RuleOf(config.LLMProviderAnthropic),
+			tool:    Tool{Server: "github", Name: "get_issue"},
+			want:    "github__get_issue",
+			pattern: anthropicName,
+		},
+		{
+			name:    "alias",
+			rule:    RuleOf(config.LLMProviderAnthropic),
+			tool:    Tool{Server: "github", Name: "get_issue", Alias: "issue"},
+			want:    "github__issue",
+			pattern: anthropicName,
+		},
+		{
+			name:    "double underscores are kept",
+			rule:    RuleOf(config.LLMProviderAnthropic),
+			tool:    Tool{Server: "my__server", Name: "get__file"},
+			want:    "my__server__get__file",
+			pattern: anthropicName,
+		},
+		{
+			name:    "rejected characters are replaced",
+			rule:    RuleOf(config.LLMProviderAnthropic),
+			tool:    Tool{Server: "my server", Name: "get.file:v2"},
+			want:    "my_server__get_file_v2",
+			pattern: anthropicName,
+		},
+		{
+			name:    "google accepts dots and colons",
+			rule:    RuleOf(config.LLMProviderGoogle),
+			tool:    Tool{Server: "my server", Name: "get.file:v2"},
+			want:    "my_server__get.file:v2",
+			pattern: googleName,
+		},
+		{
+			name:    "google rejects leading digit",
+			rule:    RuleOf(config.LLMProviderGoogle),
+			tool:    Tool{Server: "1password", Name: "get"},
+			want:    "_1password__get",
+			pattern: googleName,
+		},
+		{
+			name:    "google rejects leading hyphen",
+			rule:    RuleOf(config.LLMProviderGoogle),
+			tool:    Tool{Server: "-srv", Name: "get"},
+			want:    "_-srv__get",
+			pattern: googleName,
+		},
+		{
+			name:    "mixed providers follow both rules",
+			rule:    RuleOf(config.LLMProviderGoogle, config.LLMProviderAnthropic),
+			tool:    Tool{Server: "1srv", Name: "get.file"},
+			want:    "_1srv__get_file",
+			pattern: googleName,
+		},
+		{
+			name:    "too long",
+			rule:    RuleOf(config.LLMProviderAnthropic),
+			tool:    Tool{Server: "srv", Name: long},
+			want:    ("srv__" + long)[:64-hashLength-1] + "_" + hash(Tool{Server: "srv", Name: long}),
+			pattern: anthropicName,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry(tt.rule)
+			got := r.Name(tt.tool)
+			if got != tt.want {
+				t.Errorf("Name() = %q, want %q", got, tt.want)
+			}
+			if !tt.pattern.MatchString(got) {
+				t.Errorf("Name() = %q, does not match %s", got, tt.pattern)
+			}
+			if again := r.Name(tt.tool); again != got {
+				t.Errorf("Name() again = %q, want the same name %q", again, got)
+			}
+			server, tool, ok := r.Resolve(got)
+			if !ok || server != tt.tool.Server || tool != tt.tool.Name {
+				t.Errorf("Resolve(%q) = %q, %q, %v, want %q, %q, true", got, server, tool, ok, tt.tool.Server, tt.tool.Name)
+			}
+		})
+	}
+}
+
+func TestRegistry_Name_Collision(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		tools []Tool
+	}{
+		{
+			name:  "separator in server and tool names",
+			rule:  RuleOf(config.LLMProviderAnthropic),
+			tools: []Tool{{Server: "a__b", Name: "c"}, {Server: "a", Name: "b__c"}},
+		},
+		{
+			name:  "sanitized to the same name",
+			rule:  RuleOf(config.LLMProviderAnthropic),
+			tools: []Tool{{Server: "srv", Name: "get.file"}, {Server: "srv", Name: "get:file"}, {Server: "srv", Name: "get_file"}},
+		},
+		{
+			name:  "alias of another tool",
+			rule:  RuleOf(config.LLMProviderAnthropic),
+			tools: []Tool{{Server: "srv", Name: "search"}, {Server: "srv", Name: "find", Alias: "search"}},
+		},
+		{
+			name:  "hash taken by another tool",
+			rule:  RuleOf(config.LLMProviderAnthropic),
+			tools: []Tool{{Server: "srv", Name: "get_file"}, {Server: "srv", Name: "get_file_" + hash(Tool{Server: "srv", Name: "get.file"})}, {Server: "srv", Name: "get.file"}},
+		},
+		{
+			name: "truncated to the same name",
+			rule: RuleOf(config.LLMProviderAnthropic),
+			tools: []Tool{
+				{Server: "srv", Name: strings.Repeat("x", 100) + "a"},
+				{Server: "srv", Name: strings.Repeat("x", 100) + "b"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry(tt.rule)
+			seen := make(map[string]Tool)
+			for _, tool := range tt.tools {
+				name := r.Name(tool)
+				if other, ok := seen[name]; ok {
+					t.Fatalf("Name(%+v) = %q, already assigned to %+v", tool, name, other)
+				}
+				seen[name] = tool
+				if !anthropicName.MatchString(name) {
+					t.Errorf("Name(%+v) = %q, does not match %s", tool, name, anthropicName)
+				}
+			}
+			for name, tool := range seen {
+				server, toolName, ok := r.Resolve(name)
+				if !ok || server != tool.Server || toolName != tool.Name {
+					t.Errorf("Resolve(%q) = %q, %q, %v, want %q, %q, true", name, server, toolName, ok, tool.Server, tool.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistry_SetRule(t *testing.T) {
+	tool := Tool{Server: "srv", Name: "get.file"}
+	r := NewRegistry(RuleOf(config.LLMProviderGoogle))
+	before := r.Name(tool)
+	if before != "srv__get.file" {
+		t.Fatalf("Name() = %q, want %q", before, "srv__get.file")
+	}
+
+	r.SetRule(RuleOf(config.LLMProviderAnthropic))
+	after := r.Name(tool)
+	if after != "srv__get_file" {
+		t.Errorf("Name() after SetRule = %q, want %q", after, "srv__get_file")
+	}
+	for _, name := range []string{before, after} {
+		server, toolName, ok := r.Resolve(name)
+		if !ok || server != tool.Server || toolName != tool.Name {
+			t.Errorf("Resolve(%q) = %q, %q, %v, want %q, %q, true", name, server, toolName, ok, tool.Server, tool.Name)
+		}
+	}
+
+	// the name handed out before the switch is not given to another tool
+	other := Tool{Server: "srv", Name: "get.file", Alias: "get.file"}
+	r.SetRule(RuleOf(config.LLMProviderGoogle))
+	if name := r.Name(other); name == before {
+		t.Errorf("Name(%+v) = %q, reuses the name of %+v", other, name, tool)
+	}
+}
+
+func TestRegistry_Hold(t *testing.T) {
+	kept := Tool{Server: "srv", Name: "kept"}
+	removed := Tool{Server: "srv", Name: "get.file"}
+	shared := Tool{Server: "srv", Name: "shared"}
+	r := NewRegistry(RuleOf(config.LLMProviderGoogle))
+	first, second := new(int), new(int)
+	r.Hold(first, []Tool{kept, removed, shared})
+	r.Hold(second, []Tool{shared})
+	sharedName := r.Name(shared)
+	removedName := r.Name(removed)
+	r.SetRule(RuleOf(config.LLMProviderAnthropic))
+	removedNames := []string{removedName, r.Name(removed)}
+
+	r.Hold(first, []Tool{kept, shared})
+	for _, name := range removedNames {
+		if server, tool, ok := r.Resolve(name); ok {
+			t.Errorf("Resolve(%q) of removed tool = %q, %q, true, want false", name, server, tool)
+		}
+	}
+	// the name of the removed tool is free for other tools
+	other := Tool{Server: "srv", Name: "get:file"}
+	if name := r.Name(other); name != removedNames[1] {
+		t.Errorf("Name(%+v) = %q, want the name of the removed tool %q", other, name, removedNames[1])
+	}
+
+	keptName := r.Name(kept)
+	r.Release(first)
+	if _, _, ok := r.Resolve(sharedName); !ok {
+		t.Errorf("Resolve(%q) = false, want true while held by another owner", sharedName)
+	}
+	if _, _, ok := r.Resolve(keptName); ok {
+		t.Errorf("Resolve(%q) of released tool = true, want false", keptName)
+	}
+	r.Release(second)
+	if _, _, ok := r.Resolve(sharedName); ok {
+		t.Errorf("Resolve(%q) = true, want false after all owners release it", sharedName)
+	}
+}
+
+func TestRegistry_Resolve_Unknown(t *testing.T) {
+	r := NewRegistry(RuleOf(config.LLMProviderAnthropic))
+	r.Name(Tool{Server: "srv", Name: "tool"})
+	if server, tool, ok := r.Resolve("srv__other"); ok {
+		t.Errorf("Resolve() = %q, %q, true, want false", server, tool)
+	}
+}
+
+func TestRuleOf_Provider(t *testing.T) {
+	tests := []struct {
+		providers []string
+		want      string
+	}{
+		{providers: []string{config.LLMProviderAnthropic}, want: "anthropic"},
+		{providers: []string{config.LLMProviderGoogle, config.LLMProviderAnthropic, config.LLMProviderGoogle}, want: "anthropic,google"},
+		{providers: nil, want: ""},
+	}
+	for _, tt := range tests {
+		if got := RuleOf(tt.providers...).Provider; got != tt.want {
+			t.Errorf("RuleOf(%v).Provider = %q, want %q", tt.providers, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package toolname
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/miyamo2/slackbot-mcp-host/internal/config"
+)
+
+// Rule is the restriction of the tool names of the LLM providers.
+type Rule struct {
+	// Provider identifies the providers of the rule, such as `anthropic,google`.
+	Provider string
+	// MaxLength is the maximum length of the names.
+	MaxLength int
+	// allowed reports whether the character is allowed in the names.
+	allowed func(r rune) bool
+	// leading reports whether the character is allowed at the beginning of the names. any allowed character if nil.
+	leading func(r rune) bool
+}
+
+// RuleOf returns the rule of the tool names accepted by all of the LLM providers, as the names are shared among them.
+func RuleOf(providers ...string) Rule {
+	providers = slices.Compact(slices.Sorted(slices.Values(providers)))
+	if len(providers) == 0 {
+		return ruleOf("")
+	}
+	rule := ruleOf(providers[0])
+	for _, provider := range providers[1:] {
+		rule = rule.and(ruleOf(provider))
+	}
+	rule.Provider = strings.Join(providers, ",")
+	return rule
+}
+
+// ruleOf returns the rule of the tool names of the LLM provider.
+// the rule of the unknown providers is the strictest one, which the major providers accept.
+func ruleOf(provider string) Rule {
+	switch provider {
+	case config.LLMProviderGoogle:
+		// must start with a letter or an underscore, and may contain dots and colons
+		return Rule{
+			Provider:  provider,
+			MaxLength: 64,
+			allowed: func(r rune) bool {
+				return isAlnum(r) || strings.ContainsRune("_-.:", r)
+			},
+			leading: func(r rune) bool {
+				return isAlpha(r) || r == '_'
+			},
+		}
+	default:
+		// `^[a-zA-Z0-9_-]{1,64}$` of anthropic and openai
+		return Rule{
+			Provider:  provider,
+			MaxLength: 64,
+			allowed: func(r rune) bool {
+				return isAlnum(r) || r == '_' || r == '-'
+			},
+		}
+	}
+}
+
+// and returns the rule that the names following both r and other follow.
+func (r Rule) and(other Rule) Rule {
+	rule := Rule{
+		Provider:  r.Provider,
+		MaxLength: min(r.MaxLength, other.MaxLength),
+		allowed: func(c rune) bool {
+			return r.allowed(c) && other.allowed(c)
+		},
+	}
+	if r.leading != nil || other.leading != nil {
+		rule.leading = func(c rune) bool {
+			return (r.leading == nil || r.leading(c)) && (other.leading == nil || other.leading(c))
+		}
+	}
+	return rule
+}
+
+// sanitize returns the name of the tool following the rule.
+// the characters not allowed are replaced with underscores, and the long name is truncated with the hash of the tool.
+func (r Rule) sanitize(tool Tool) string {
+	var b strings.Builder
+	for i, c := range tool.Server + separator + tool.shown() {
+		switch {
+		case i == 0 && r.leading != nil && !r.leading(c):
+			b.WriteRune('_')
+			if r.allowed(c) {
+				b.WriteRune(c)
+			}
+		case r.allowed(c):
+			b.WriteRune(c)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	name := b.String()
+	if len(name) > r.MaxLength {
+		return r.withSuffix(name, hash(tool))
+	}
+	return name
+}
+
+func isAlpha(r rune) bool {
+	return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+}
+
+func isAlnum(r rune) bool {
+	return isAlpha(r) || ('0' <= r && r <= '9')
+}